@@ -0,0 +1,124 @@
+package cmd
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Helpers for converting names between the cases used in rust code.
+
+// words splits a name in any case into its lower case words, ie. ParseInt,
+// parse_int and parse-int all give parse and int. A run of capitals is one
+// word, so HTTPServer gives http and server.
+func words(s string) []string {
+	var result []string
+	var word []rune
+	runes := []rune(s)
+	flush := func() {
+		if len(word) > 0 {
+			result = append(result, strings.ToLower(string(word)))
+			word = nil
+		}
+	}
+	for i, r := range runes {
+		switch {
+		case r == '_' || r == '-' || r == ' ' || r == '.':
+			flush()
+			continue
+		case unicode.IsUpper(r) && len(word) > 0:
+			prev := runes[i-1]
+			nextLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			if !unicode.IsUpper(prev) || nextLower {
+				flush()
+			}
+		}
+		word = append(word, r)
+	}
+	flush()
+	return result
+}
+
+// upperCamel converts a name to UpperCamelCase, the case of rust types
+func upperCamel(s string) string {
+	return joinWords(s, "", title)
+}
+
+// lowerWords converts a name to lower case words separated by spaces, for
+// messages
+func lowerWords(s string) string {
+	return strings.Join(words(s), " ")
+}
+
+// joinWords converts a name to its words joined by sep, with each word
+// changed by f
+func joinWords(s, sep string, f func(string) string) string {
+	ws := words(s)
+	for i, w := range ws {
+		ws[i] = f(w)
+	}
+	return strings.Join(ws, sep)
+}
+
+// title capitalizes the first letter of a word
+func title(w string) string {
+	r := []rune(w)
+	return strings.ToUpper(string(r[0])) + string(r[1:])
+}
+
+// nameCases convert names to the cases of the --case flag of stringer, by
+// the name of the case without separators
+var nameCases = map[string]func(string) string{
+	"snake":          func(s string) string { return joinWords(s, "_", strings.ToLower) },
+	"kebab":          func(s string) string { return joinWords(s, "-", strings.ToLower) },
+	"screamingsnake": func(s string) string { return joinWords(s, "_", strings.ToUpper) },
+	"lower":          strings.ToLower,
+	"title":          func(s string) string { return joinWords(s, " ", title) },
+}
+
+// nameCase finds the conversion for a case, which is named as in serde, ie.
+// kebab-case or SCREAMING_SNAKE_CASE, or more loosely, ie. kebab or
+// screaming_snake. No case keeps names as they are.
+func nameCase(name string) (func(string) string, bool) {
+	key := strings.ToLower(strings.NewReplacer("_", "", "-", "", " ", "").Replace(name))
+	key = strings.TrimSuffix(key, "case")
+	switch key {
+	case "":
+		return func(s string) string { return s }, true
+	case "screaming":
+		key = "screamingsnake"
+	}
+	f, ok := nameCases[key]
+	return f, ok
+}
+
+// rustKeywords are the strict and reserved keywords of rust, which cannot
+// name an item
+var rustKeywords = map[string]bool{
+	"as": true, "break": true, "const": true, "continue": true, "crate": true,
+	"else": true, "enum": true, "extern": true, "false": true, "fn": true,
+	"for": true, "if": true, "impl": true, "in": true, "let": true,
+	"loop": true, "match": true, "mod": true, "move": true, "mut": true,
+	"pub": true, "ref": true, "return": true, "self": true, "Self": true,
+	"static": true, "struct": true, "super": true, "trait": true, "true": true,
+	"type": true, "unsafe": true, "use": true, "where": true, "while": true,
+	"async": true, "await": true, "dyn": true, "abstract": true, "become": true,
+	"box": true, "do": true, "final": true, "macro": true, "override": true,
+	"priv": true, "typeof": true, "unsized": true, "virtual": true,
+	"yield": true, "try": true, "gen": true, "_": true,
+}
+
+// isIdentifier reports whether s is a legal name for a rust item
+func isIdentifier(s string) bool {
+	if s == "" || rustKeywords[s] {
+		return false
+	}
+	for i, r := range s {
+		switch {
+		case r == '_' || unicode.IsLetter(r):
+		case i > 0 && unicode.IsDigit(r):
+		default:
+			return false
+		}
+	}
+	return true
+}
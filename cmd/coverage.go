@@ -0,0 +1,153 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/skreimeyer/rustbuddy/rust"
+)
+
+// Helpers for matching functions with the tests that already exist for them.
+
+// tested holds the names of the existing tests for the current source file.
+// It must be set before executing the mktest template.
+var tested map[string]bool
+
+// testNames collects the names of the #[test] functions in src
+func testNames(src rust.Source) map[string]bool {
+	names := make(map[string]bool)
+	for _, t := range src.Tests {
+		names[t.Name] = true
+	}
+	return names
+}
+
+// testName gives the name mktest uses for the test of a function, ie.
+// test_<fn> or test_<Type>_<method>. Methods of a trait impl also name the
+// trait, as in test_<Type>_<Trait>_<method>.
+func testName(q qualified) string {
+	name := "test_"
+	if q.Type != "" {
+		name += q.Type + "_"
+	}
+	if q.Trait != "" {
+		name += q.Trait + "_"
+	}
+	return name + q.Fn.Name
+}
+
+// displayName gives the path of a function as written in rust, ie.
+// Type::method or <Type as Trait>::method
+func displayName(q qualified) string {
+	switch {
+	case q.Trait != "":
+		return "<" + q.Type + " as " + q.Trait + ">::" + q.Fn.Name
+	case q.Type != "":
+		return q.Type + "::" + q.Fn.Name
+	}
+	return q.Fn.Name
+}
+
+// isTested reports whether a test already exists for the function. A trait
+// method is also tested by a test named without the trait, as in
+// test_<Type>_<method>.
+func isTested(q qualified) bool {
+	if q.Trait != "" && tested[testName(qualified{Type: q.Type, Fn: q.Fn})] {
+		return true
+	}
+	return tested[testName(q)]
+}
+
+// testable lists every function of src that mktest writes a test for
+func testable(src rust.Source) []qualified {
+	var fns []qualified
+	for _, f := range src.Funcs {
+		if f.Name != "main" {
+			fns = append(fns, qualify("", "", f))
+		}
+	}
+	for _, s := range src.RsStructs {
+		for _, f := range s.Methods {
+			fns = append(fns, qualify(s.Name, "", f))
+		}
+		for _, t := range s.Traits {
+			for _, f := range t.Methods {
+				fns = append(fns, qualify(s.Name, t.Name, f))
+			}
+		}
+	}
+	for _, t := range src.Traits {
+		if impl := implFor(t.Name); impl != "" {
+			for _, f := range t.Defaults {
+				fns = append(fns, qualify(impl, t.Name, f))
+			}
+		}
+	}
+	return fns
+}
+
+// gaps lists the functions of src which have no test yet
+func gaps(src rust.Source) []qualified {
+	var missing []qualified
+	for _, q := range testable(src) {
+		if !isTested(q) {
+			missing = append(missing, q)
+		}
+	}
+	return missing
+}
+
+// reportGaps prints the functions without a test for each file or crate
+// directory in args. Tests of a crate count wherever they are in the crate,
+// so a test in tests/ covers a function in src/.
+func reportGaps(args []string) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	defer w.Flush()
+	total, untested := 0, 0
+	for _, arg := range args {
+		files := []string{arg}
+		if info, err := os.Stat(arg); err == nil && info.IsDir() {
+			root, err := findCrate(arg)
+			if err != nil {
+				root = arg
+			}
+			files, err = rustFiles(root)
+			if err != nil {
+				fmt.Println("Cannot list source files:", err)
+				continue
+			}
+		}
+		sources := make(map[string]rust.Source)
+		tested = make(map[string]bool)
+		for _, fname := range files {
+			f, err := os.Open(fname)
+			if err != nil {
+				fmt.Println("File Read error:", err)
+				continue
+			}
+			source, err := rust.Parse(f)
+			f.Close()
+			if err != nil {
+				fmt.Println("Parsing error:", err)
+				continue
+			}
+			sources[fname] = source
+			for name := range testNames(source) {
+				tested[name] = true
+			}
+		}
+		for _, fname := range files {
+			source, ok := sources[fname]
+			if !ok {
+				continue
+			}
+			total += len(testable(source))
+			for _, q := range gaps(source) {
+				untested++
+				fmt.Fprintf(w, "%s:%d\t%s\t%s\n", fname, q.Fn.Span.Start.Line, displayName(q), testName(q))
+			}
+		}
+	}
+	fmt.Fprintf(w, "%d of %d functions have no test\n", untested, total)
+}
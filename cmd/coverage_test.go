@@ -0,0 +1,72 @@
+package cmd
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/skreimeyer/rustbuddy/rust"
+)
+
+// parseCode parses code as the source file lib.rs
+func parseCode(t *testing.T, code string) rust.Source {
+	dir, err := ioutil.TempDir("", "source")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	fname := filepath.Join(dir, "lib.rs")
+	if err := ioutil.WriteFile(fname, []byte(code), 0644); err != nil {
+		t.Fatal(err)
+	}
+	f, _ := os.Open(fname)
+	defer f.Close()
+	src, err := rust.Parse(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return src
+}
+
+func TestGapsTraitMethods(t *testing.T) {
+	src := parseCode(t, `pub trait HasArea {
+    fn area(&self) -> f64;
+}
+
+pub struct R;
+pub struct S;
+
+impl HasArea for R {
+    fn area(&self) -> f64 { 1.0 }
+}
+
+impl HasArea for S {
+    fn area(&self) -> f64 { 2.0 }
+}
+
+pub struct T;
+
+impl HasArea for T {
+    fn area(&self) -> f64 { 3.0 }
+}
+
+#[cfg(test)]
+mod tests {
+    #[test]
+    fn test_R_area() {}
+
+    #[test]
+    fn test_S_HasArea_area() {}
+}
+`)
+	tested = testNames(src)
+	defer func() { tested = nil }()
+	var missing []string
+	for _, q := range gaps(src) {
+		missing = append(missing, displayName(q))
+	}
+	if len(missing) != 1 || missing[0] != "<T as HasArea>::area" {
+		t.Errorf("Expected only <T as HasArea>::area untested. Found %v", missing)
+	}
+}
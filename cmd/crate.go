@@ -0,0 +1,199 @@
+package cmd
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Helpers for commands which operate on a whole crate rather than a single
+// source file.
+
+// findCrate walks up from dir until it finds a Cargo.toml and returns the
+// directory that contains it.
+func findCrate(dir string) (string, error) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	for {
+		if _, err := os.Stat(filepath.Join(abs, "Cargo.toml")); err == nil {
+			return abs, nil
+		}
+		parent := filepath.Dir(abs)
+		if parent == abs {
+			return "", errors.New("cannot find Cargo.toml in " + dir + " or its parents")
+		}
+		abs = parent
+	}
+}
+
+// crateName reads the package name from the Cargo.toml in root. Hyphens are
+// replaced so the result can be used in a rust path.
+func crateName(root string) (string, error) {
+	name, err := packageName(root)
+	return strings.Replace(name, "-", "_", -1), err
+}
+
+// packageName reads the package name from the Cargo.toml in root
+func packageName(root string) (string, error) {
+	content, err := ioutil.ReadFile(filepath.Join(root, "Cargo.toml"))
+	if err != nil {
+		return "", errors.New("cannot read Cargo.toml")
+	}
+	inPackage := false
+	re := regexp.MustCompile(`^name\s*=\s*"([^"]+)"`)
+	for _, line := range strings.Split(string(content), "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "[") {
+			inPackage = line == "[package]"
+			continue
+		}
+		if m := re.FindStringSubmatch(line); inPackage && m != nil {
+			return m[1], nil
+		}
+	}
+	return "", errors.New("cannot find package name in Cargo.toml")
+}
+
+// rustFiles lists every .rs file below dir. Build output and hidden
+// directories are skipped.
+func rustFiles(dir string) ([]string, error) {
+	var files []string
+	err := filepath.Walk(dir, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			if p != dir && (info.Name() == "target" || strings.HasPrefix(info.Name(), ".")) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if strings.HasSuffix(p, ".rs") {
+			files = append(files, p)
+		}
+		return nil
+	})
+	return files, err
+}
+
+// modulePath converts the path of a source file to its module path within
+// the crate rooted at root, ie. src/net/mod.rs becomes crate::net. Files
+// outside of src are crate roots of their own and are named by their path.
+func modulePath(root, file string) string {
+	rel, err := filepath.Rel(root, file)
+	if err != nil {
+		rel = file
+	}
+	parts := strings.Split(filepath.ToSlash(rel), "/")
+	last := strings.TrimSuffix(parts[len(parts)-1], ".rs")
+	parts = parts[:len(parts)-1]
+	if len(parts) > 0 && parts[0] == "src" {
+		parts[0] = "crate"
+		if len(parts) == 1 && (last == "lib" || last == "main") {
+			return "crate"
+		}
+	}
+	if last != "mod" {
+		parts = append(parts, last)
+	}
+	return strings.Join(parts, "::")
+}
+
+// crateModule finds the crate of a source file in its src directory and gives
+// the crate root along with the path by which other crates reach the module,
+// ie. mycrate::net.
+func crateModule(fname string) (string, string, error) {
+	abs, err := filepath.Abs(fname)
+	if err != nil {
+		return "", "", err
+	}
+	root, err := findCrate(filepath.Dir(abs))
+	if err != nil {
+		return "", "", err
+	}
+	name, err := crateName(root)
+	if err != nil {
+		return "", "", err
+	}
+	path := modulePath(root, abs)
+	if !strings.HasPrefix(path, "crate") {
+		return "", "", errors.New(fname + " is not part of the crate's src directory")
+	}
+	return root, name + strings.TrimPrefix(path, "crate"), nil
+}
+
+// lastSegment gives the last name of a path such as mycrate::net
+func lastSegment(path string) string {
+	parts := strings.Split(path, "::")
+	return parts[len(parts)-1]
+}
+
+// addDevDependency adds a dev-dependency to the Cargo.toml in root unless the
+// crate already depends on it.
+func addDevDependency(root, name, version string) error {
+	return addDependency(root, "dev-dependencies", name, version)
+}
+
+// addDependency adds an entry to a dependency section of the Cargo.toml in
+// root, ie. dependencies, unless the section already has one.
+func addDependency(root, table, name, version string) error {
+	manifest := filepath.Join(root, "Cargo.toml")
+	content, err := ioutil.ReadFile(manifest)
+	if err != nil {
+		return errors.New("cannot read Cargo.toml")
+	}
+	text := string(content)
+	section := ""
+	re := regexp.MustCompile(`^` + regexp.QuoteMeta(name) + `\s*=`)
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "[") {
+			section = line
+		} else if section == "["+table+"]" && re.MatchString(line) {
+			return nil
+		}
+	}
+	entry := name + " = \"" + version + "\"\n"
+	header := "[" + table + "]\n"
+	if i := strings.Index(text, header); i != -1 {
+		i += len(header)
+		text = text[:i] + entry + text[i:]
+	} else {
+		text = strings.TrimRight(text, "\n") + "\n\n" + header + entry
+	}
+	return ioutil.WriteFile(manifest, []byte(text), 0644)
+}
+
+// addTarget adds a target table such as [[bench]] to the Cargo.toml in root,
+// unless a target of that kind with the same name exists. Each of the fields
+// is a line of the table, ie. harness = false.
+func addTarget(root, kind, name string, fields ...string) error {
+	manifest := filepath.Join(root, "Cargo.toml")
+	content, err := ioutil.ReadFile(manifest)
+	if err != nil {
+		return errors.New("cannot read Cargo.toml")
+	}
+	text := string(content)
+	header := "[[" + kind + "]]"
+	section := ""
+	re := regexp.MustCompile(`^name\s*=\s*"` + regexp.QuoteMeta(name) + `"`)
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "[") {
+			section = line
+		} else if section == header && re.MatchString(line) {
+			return nil
+		}
+	}
+	table := "\n" + header + "\nname = \"" + name + "\"\n"
+	for _, f := range fields {
+		table += f + "\n"
+	}
+	text = strings.TrimRight(text, "\n") + "\n" + table
+	return ioutil.WriteFile(manifest, []byte(text), 0644)
+}
@@ -0,0 +1,57 @@
+package cmd
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// tempCrate creates a crate named my-crate with the given source files and
+// gives its root
+func tempCrate(t *testing.T, files ...string) string {
+	root, err := ioutil.TempDir("", "crate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(root, "Cargo.toml"), []byte("[package]\nname = \"my-crate\"\nversion = \"0.1.0\"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range files {
+		p := filepath.Join(root, f)
+		os.MkdirAll(filepath.Dir(p), 0755)
+		if err := ioutil.WriteFile(p, []byte("pub fn f() {}\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return root
+}
+
+func TestCrateModuleFromSubdirectory(t *testing.T) {
+	root := tempCrate(t, "src/lib.rs", "src/net/mod.rs", "src/net/tcp.rs")
+	defer os.RemoveAll(root)
+	wd, _ := os.Getwd()
+	defer os.Chdir(wd)
+	if err := os.Chdir(filepath.Join(root, "src")); err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct{ fname, path, name string }{
+		{"lib.rs", "my_crate", "MyCrate"},
+		{"net/mod.rs", "my_crate::net", "Net"},
+		{filepath.Join("net", "tcp.rs"), "my_crate::net::tcp", "Tcp"},
+		{"./../src/net/tcp.rs", "my_crate::net::tcp", "Tcp"},
+	}
+	for _, c := range cases {
+		_, path, err := crateModule(c.fname)
+		if err != nil {
+			t.Errorf("crateModule(%q): %v", c.fname, err)
+			continue
+		}
+		if path != c.path {
+			t.Errorf("crateModule(%q) = %q, want %q", c.fname, path, c.path)
+		}
+		if name := makeName(c.fname); name != c.name {
+			t.Errorf("makeName(%q) = %q, want %q", c.fname, name, c.name)
+		}
+	}
+}
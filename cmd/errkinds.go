@@ -0,0 +1,194 @@
+package cmd
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/skreimeyer/rustbuddy/rust"
+)
+
+// Helpers for finding the errors a source file propagates, which become the
+// variants of the error enum generated by mkerr.
+
+// errVariant is a variant of the generated error enum wrapping another error
+type errVariant struct {
+	Name string // ie. Io
+	Type string // ie. std::io::Error
+}
+
+// errorCalls recognize calls failing with a known error type in an
+// expression which is propagated with ?
+var errorCalls = []struct {
+	re  *regexp.Regexp
+	typ string
+}{
+	{regexp.MustCompile(`\b(File|OpenOptions|fs|TcpStream|TcpListener|UdpSocket|io)::`), "std::io::Error"},
+	{regexp.MustCompile(`\.(read_to_string|read_to_end|read_line|read_exact|write_all|flush|sync_all|metadata|read_dir)\(`), "std::io::Error"},
+	{regexp.MustCompile(`\.parse::<\s*[iu](8|16|32|64|128|size)\s*>`), "std::num::ParseIntError"},
+	{regexp.MustCompile(`\.parse::<\s*f(32|64)\s*>`), "std::num::ParseFloatError"},
+	{regexp.MustCompile(`\.parse::<\s*bool\s*>`), "std::str::ParseBoolError"},
+	{regexp.MustCompile(`\.parse::<\s*char\s*>`), "std::char::ParseCharError"},
+	{regexp.MustCompile(`String::from_utf8\(`), "std::string::FromUtf8Error"},
+	{regexp.MustCompile(`\bstr::from_utf8\(`), "std::str::Utf8Error"},
+	{regexp.MustCompile(`\benv::var\(`), "std::env::VarError"},
+	{regexp.MustCompile(`\bserde_json::`), "serde_json::Error"},
+}
+
+// annotatedParse finds a parse whose type is given by the let binding, ie.
+// let n: u32 = s.parse()
+var annotatedParse = regexp.MustCompile(`let\s+(?:mut\s+)?\w+\s*:\s*(\w+)\s*=.*\.parse\(\)`)
+
+// pathSpace matches a path separator with the space around it, ie. io :: Error
+var pathSpace = regexp.MustCompile(`\s*::\s*`)
+
+// propagatedErrors lists the error types src returns or propagates with ?,
+// except the error named self which is being generated. Errors which carry
+// no type, such as String or Box<dyn Error>, are left out.
+func propagatedErrors(src rust.Source, self string) []errVariant {
+	var fns []rust.Fn
+	fns = append(fns, src.Funcs...)
+	for _, s := range src.RsStructs {
+		fns = append(fns, s.Methods...)
+		for _, t := range s.Traits {
+			fns = append(fns, t.Methods...)
+		}
+	}
+	for _, t := range src.Traits {
+		fns = append(fns, t.Defaults...)
+	}
+	var found []string
+	seen := map[string]bool{self: true}
+	add := func(t string) {
+		t = canonicalError(pathSpace.ReplaceAllString(strings.Join(strings.Fields(t), " "), "::"))
+		if !seen[t] && !opaqueError(t) {
+			seen[t] = true
+			found = append(found, t)
+		}
+	}
+	for _, f := range fns {
+		head, args := rust.SplitGeneric(strings.TrimSpace(f.Return))
+		switch {
+		case rust.BaseName(head) == "Result" && strings.HasSuffix(head, "io::Result"):
+			add("std::io::Error")
+		case rust.BaseName(head) == "Result" && len(args) == 2:
+			add(args[1])
+		}
+		for _, expr := range tryExprs(f.Body) {
+			for _, c := range errorCalls {
+				if c.re.MatchString(expr) {
+					add(c.typ)
+				}
+			}
+			if m := annotatedParse.FindStringSubmatch(expr); m != nil {
+				add(parseError(m[1]))
+			}
+		}
+	}
+	return nameVariants(found)
+}
+
+// stdErrors are the full paths of errors from the standard library by the
+// names they are usually imported as
+var stdErrors = map[string]string{
+	"io::Error":          "std::io::Error",
+	"fmt::Error":         "std::fmt::Error",
+	"ParseIntError":      "std::num::ParseIntError",
+	"ParseFloatError":    "std::num::ParseFloatError",
+	"TryFromIntError":    "std::num::TryFromIntError",
+	"ParseBoolError":     "std::str::ParseBoolError",
+	"Utf8Error":          "std::str::Utf8Error",
+	"ParseCharError":     "std::char::ParseCharError",
+	"FromUtf8Error":      "std::string::FromUtf8Error",
+	"VarError":           "std::env::VarError",
+	"SystemTimeError":    "std::time::SystemTimeError",
+	"AddrParseError":     "std::net::AddrParseError",
+	"RecvError":          "std::sync::mpsc::RecvError",
+	"num::ParseIntError": "std::num::ParseIntError",
+}
+
+// canonicalError gives the full path of errors from the standard library, so
+// that each is wrapped once however it is named.
+func canonicalError(t string) string {
+	if full, ok := stdErrors[strings.TrimPrefix(t, "std::")]; ok {
+		return full
+	}
+	return t
+}
+
+// parseError gives the error of parsing a string into the primitive type t
+func parseError(t string) string {
+	switch t {
+	case "i8", "i16", "i32", "i64", "i128", "isize", "u8", "u16", "u32", "u64", "u128", "usize":
+		return "std::num::ParseIntError"
+	case "f32", "f64":
+		return "std::num::ParseFloatError"
+	case "bool":
+		return "std::str::ParseBoolError"
+	case "char":
+		return "std::char::ParseCharError"
+	}
+	return ""
+}
+
+// opaqueError reports whether an error type cannot be wrapped by a variant:
+// messages, trait objects, generic parameters and the unit type.
+func opaqueError(t string) bool {
+	switch {
+	case t == "" || t == "()" || t == "String" || strings.HasPrefix(t, "&"):
+		return true
+	case strings.HasPrefix(t, "Box<") || strings.HasPrefix(t, "dyn ") || strings.HasPrefix(t, "impl "):
+		return true
+	case len(t) == 1: // a generic parameter, ie. E
+		return true
+	case rust.BaseName(t) == "Error" && !strings.Contains(t, "::"):
+		return true // most likely a Result alias of the file itself
+	}
+	return false
+}
+
+// tryExprs gives the text of each expression in body which is propagated
+// with ?, from the start of its statement.
+func tryExprs(body string) []string {
+	var exprs []string
+	for i, c := range body {
+		if c != '?' {
+			continue
+		}
+		if i+1 < len(body) && (body[i+1] == '_' || isLetter(body[i+1])) {
+			continue // ?Sized
+		}
+		start := strings.LastIndexAny(body[:i], ";{}") + 1
+		exprs = append(exprs, body[start:i])
+	}
+	return exprs
+}
+
+func isLetter(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+// nameVariants names the variant wrapping each error type after the type,
+// ie. ParseInt for std::num::ParseIntError, or after its module when the
+// type is only called Error, ie. Io for std::io::Error.
+func nameVariants(types []string) []errVariant {
+	var variants []errVariant
+	used := map[string]bool{"Other": true}
+	for _, t := range types {
+		head, _ := rust.SplitGeneric(t)
+		parts := strings.Split(head, "::")
+		name := strings.TrimSuffix(parts[len(parts)-1], "Error")
+		if name == "" && len(parts) > 1 {
+			name = upperCamel(parts[len(parts)-2])
+		}
+		if name == "" {
+			name = "Error"
+		}
+		for base, n := name, 2; used[name]; n++ {
+			name = base + strconv.Itoa(n)
+		}
+		used[name] = true
+		variants = append(variants, errVariant{Name: name, Type: t})
+	}
+	return variants
+}
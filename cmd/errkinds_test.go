@@ -0,0 +1,55 @@
+package cmd
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestPropagatedErrors(t *testing.T) {
+	cases := []struct {
+		name, code string
+		want       []errVariant
+	}{
+		{"io however it is named", `use std::io;
+fn a() -> io::Result<()> { Ok(()) }
+fn b() -> Result<(), io::Error> { Ok(()) }
+fn c() -> Result<(), std::io::Error> { Ok(()) }
+fn d() -> Result<(), std :: io :: Error> { Ok(()) }
+fn e() -> Result<String, Box<dyn std::error::Error>> {
+    let f = File::open("x")?;
+    let mut s = String::new();
+    f.read_to_string(&mut s)?;
+    Ok(s)
+}`, []errVariant{{"Io", "std::io::Error"}}},
+		{"parse errors once each", `fn a(s: &str) -> Result<u32, ParseIntError> { s.parse() }
+fn b(s: &str) -> Result<u32, std::num::ParseIntError> { s.parse() }
+fn c(s: &str) -> Result<(), String> {
+    let n = s.parse::<i64>()?;
+    let m: u8 = s.parse()?;
+    let x: f64 = s.parse()?;
+    let y = s.parse::<f32>()?;
+    Ok(())
+}`, []errVariant{{"ParseInt", "std::num::ParseIntError"}, {"ParseFloat", "std::num::ParseFloatError"}}},
+		{"self and opaque errors", `struct MyError;
+fn a() -> Result<(), MyError> { Ok(()) }
+fn b() -> Result<(), String> { Ok(()) }
+fn c<E>() -> Result<(), E> { todo!() }
+fn d() -> Result<(), Error> { Ok(()) }
+fn e() -> Result<(), fmt::Error> { Ok(()) }`, []errVariant{{"Fmt", "std::fmt::Error"}}},
+		{"colliding names", `fn a() -> Result<(), serde_json::Error> { Ok(()) }
+fn b() -> Result<(), toml::de::Error> { Ok(()) }
+fn c() -> Result<(), csv::Error> { Ok(()) }
+fn d() -> Result<(), other::Csv> { Ok(()) }`, []errVariant{
+			{"SerdeJson", "serde_json::Error"},
+			{"De", "toml::de::Error"},
+			{"Csv", "csv::Error"},
+			{"Csv2", "other::Csv"},
+		}},
+	}
+	for _, c := range cases {
+		got := propagatedErrors(parseCode(t, c.code), "MyError")
+		if fmt.Sprint(got) != fmt.Sprint(c.want) {
+			t.Errorf("%s: propagatedErrors = %v, want %v", c.name, got, c.want)
+		}
+	}
+}
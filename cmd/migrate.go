@@ -0,0 +1,154 @@
+package cmd
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/skreimeyer/rustbuddy/rust"
+)
+
+// Helpers for migrating the functions of a source file from loosely typed
+// errors, Box<dyn Error> or String, to the error generated by mkerr.
+
+// looseError matches the error types which are migrated
+var looseError = regexp.MustCompile(`^(String|Box<\s*dyn\s+(std::error::)?Error(\s*\+\s*(Send|Sync|'static))*\s*>)$`)
+
+// errLiteral matches an error built from a string literal, ie. Err("bad".into())
+var errLiteral = regexp.MustCompile(`\bErr\(\s*("(?:[^"\\]|\\.)*")\s*\.\s*(?:into|to_string|to_owned)\(\)\s*\)|\bErr\(\s*String::from\(\s*("(?:[^"\\]|\\.)*")\s*\)\s*\)`)
+
+// okOrLiteral matches an Option turned into an error from a literal, ie.
+// .ok_or("missing")
+var okOrLiteral = regexp.MustCompile(`\.ok_or\(\s*("(?:[^"\\]|\\.)*")\s*\)`)
+
+// errFormat matches the start of an error built with format!
+var errFormat = regexp.MustCompile(`\bErr\(\s*format!\(`)
+
+// edit replaces the bytes of a file from start to end
+type edit struct {
+	start, end int
+	text       string
+}
+
+// migrate rewrites the functions of src returning Result<T, Box<dyn Error>>
+// or Result<T, String> to return the error errName instead, and the errors
+// they create from strings to errName::new. The trait methods of impl blocks
+// keep the signature of the trait, and main is left alone.
+func migrate(content []byte, src rust.Source, errName string) []byte {
+	var fns []rust.Fn
+	for _, f := range src.Funcs {
+		if f.Name != "main" {
+			fns = append(fns, f)
+		}
+	}
+	for _, s := range src.RsStructs {
+		fns = append(fns, s.Methods...)
+	}
+	var edits []edit
+	for _, f := range fns {
+		edits = append(edits, migrateFn(content, f, errName)...)
+	}
+	sort.Slice(edits, func(i, j int) bool { return edits[i].start > edits[j].start })
+	result := append([]byte{}, content...)
+	for _, e := range edits {
+		result = append(result[:e.start], append([]byte(e.text), result[e.end:]...)...)
+	}
+	return result
+}
+
+// migrateFn gives the edits migrating the function f, if it returns a loose
+// error
+func migrateFn(content []byte, f rust.Fn, errName string) []edit {
+	head, args := rust.SplitGeneric(strings.TrimSpace(f.Return))
+	if rust.BaseName(head) != "Result" || len(args) != 2 || f.Body == "" {
+		return nil
+	}
+	loose := strings.Join(strings.Fields(args[1]), " ")
+	if !looseError.MatchString(loose) {
+		return nil
+	}
+	start, end := f.Span.Start.Offset, f.Span.End.Offset
+	body := end - len(f.Body)
+	if start < 0 || end > len(content) || body <= start || content[body-1] != '{' {
+		return nil
+	}
+	sig := string(content[start:body])
+	arrow := strings.Index(sig, "->")
+	if arrow == -1 {
+		return nil
+	}
+	locs := typePattern(loose).FindAllStringIndex(sig[arrow:], -1)
+	if len(locs) == 0 {
+		return nil
+	}
+	loc := locs[len(locs)-1]
+	edits := []edit{{start + arrow + loc[0], start + arrow + loc[1], errName}}
+	return append(edits, errorSites(string(content[body:end]), body, errName)...)
+}
+
+// typePattern matches the type t however it is spaced
+func typePattern(t string) *regexp.Regexp {
+	var parts []string
+	for _, tok := range regexp.MustCompile(`[\w']+|::|\S`).FindAllString(t, -1) {
+		parts = append(parts, regexp.QuoteMeta(tok))
+	}
+	return regexp.MustCompile(strings.Join(parts, `\s*`))
+}
+
+// errorSites gives the edits creating errName instead of an error from a
+// string in body, which starts at offset in the file
+func errorSites(body string, offset int, errName string) []edit {
+	var edits []edit
+	for _, m := range errLiteral.FindAllStringSubmatchIndex(body, -1) {
+		lit, litEnd := m[2], m[3]
+		if lit == -1 { // String::from
+			lit, litEnd = m[4], m[5]
+		}
+		edits = append(edits, edit{offset + m[0], offset + m[1], "Err(" + errName + "::new(" + body[lit:litEnd] + "))"})
+	}
+	for _, m := range okOrLiteral.FindAllStringSubmatchIndex(body, -1) {
+		edits = append(edits, edit{offset + m[0], offset + m[1], ".ok_or_else(|| " + errName + "::new(" + body[m[2]:m[3]] + "))"})
+	}
+	for _, m := range errFormat.FindAllStringIndex(body, -1) {
+		open := m[1] - 1
+		close := matchParen(body, open)
+		if close == -1 {
+			continue
+		}
+		format := body[open-len("format!") : close+1]
+		rest := body[close+1:]
+		trimmed := strings.TrimLeft(rest, " \t\n")
+		if strings.HasPrefix(trimmed, ".into()") {
+			trimmed = strings.TrimLeft(trimmed[len(".into()"):], " \t\n")
+		}
+		if !strings.HasPrefix(trimmed, ")") {
+			continue
+		}
+		end := close + 1 + len(rest) - len(trimmed) + 1
+		edits = append(edits, edit{offset + m[0], offset + end, "Err(" + errName + "::new(&" + format + "))"})
+	}
+	return edits
+}
+
+// matchParen finds the parenthesis closing the one at open in s, skipping
+// over string literals
+func matchParen(s string, open int) int {
+	depth := 0
+	for i := open; i < len(s); i++ {
+		switch s[i] {
+		case '"':
+			for i++; i < len(s) && s[i] != '"'; i++ {
+				if s[i] == '\\' {
+					i++
+				}
+			}
+		case '(':
+			depth++
+		case ')':
+			if depth--; depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
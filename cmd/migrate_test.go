@@ -0,0 +1,76 @@
+package cmd
+
+import (
+	"bytes"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestErrorSites(t *testing.T) {
+	cases := []struct{ body, want string }{
+		{`Err("bad".into())`, `Err(E::new("bad"))`},
+		{`Err( "bad".to_string() )`, `Err(E::new("bad"))`},
+		{`Err("bad".to_owned())`, `Err(E::new("bad"))`},
+		{`Err(String::from("bad"))`, `Err(E::new("bad"))`},
+		{`Err("say \"hi\"".into())`, `Err(E::new("say \"hi\""))`},
+		{`Err(format!("bad {}", x))`, `Err(E::new(&format!("bad {}", x)))`},
+		{`Err(format!("a ({}", f(x)).into())`, `Err(E::new(&format!("a ({}", f(x))))`},
+		{`v.get(0).ok_or("missing")?`, `v.get(0).ok_or_else(|| E::new("missing"))?`},
+		{"return Err(\"a\".into());\n    Err(\"b\".into())", "return Err(E::new(\"a\"));\n    Err(E::new(\"b\"))"},
+		// errors which are not made from strings are left alone
+		{`let n = s.parse()?;`, `let n = s.parse()?;`},
+		{`s.parse().unwrap()`, `s.parse().unwrap()`},
+		{`f().expect("bad")`, `f().expect("bad")`},
+		{`Err(e)`, `Err(e)`},
+		{`Err(e.into())`, `Err(e.into())`},
+		{`Err(format!("{}", x).len())`, `Err(format!("{}", x).len())`},
+		{`v.get(0).ok_or(Missing)`, `v.get(0).ok_or(Missing)`},
+	}
+	for _, c := range cases {
+		const offset = 10
+		edits := errorSites(c.body, offset, "E")
+		sort.Slice(edits, func(i, j int) bool { return edits[i].start > edits[j].start })
+		got := c.body
+		for _, e := range edits {
+			got = got[:e.start-offset] + e.text + got[e.end-offset:]
+		}
+		if got != c.want {
+			t.Errorf("errorSites(%q) gives %q, want %q", c.body, got, c.want)
+		}
+	}
+}
+
+func TestMigrateStringErrors(t *testing.T) {
+	code := `pub fn half(s: &str) -> Result<f64, String> {
+    let n: f64 = s.parse().map_err(|_| String::from("nan"))?;
+    Ok(n / 2.0)
+}
+`
+	src := parseCode(t, code)
+	out := string(migrate([]byte(code), src, "E"))
+	for _, want := range []string{
+		"-> Result<f64, E> {",
+		`.map_err(|_| String::from("nan"))?`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Missing %s in:\n%s", want, out)
+		}
+	}
+	// the String error propagated with ? converts into the error
+	tmpl, err := loadTemplate("mkerr", "lib.rs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, style := range []string{"hand", "thiserror", "snafu"} {
+		var b bytes.Buffer
+		if err := tmpl.Execute(&b, customErr{E: "E", Source: src, Style: style, Migrate: true}); err != nil {
+			t.Fatal(err)
+		}
+		for _, want := range []string{"impl From<String> for E {", "impl From<&str> for E {"} {
+			if !strings.Contains(b.String(), want) {
+				t.Errorf("%s: missing %s in:\n%s", style, want, b.String())
+			}
+		}
+	}
+}
@@ -0,0 +1,191 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"github.com/skreimeyer/rustbuddy/rust"
+	"github.com/spf13/cobra"
+)
+
+// mkbenchCmd represents the mkbench command
+var mkbenchCmd = &cobra.Command{
+	Use:   "mkbench [FLAGS] [SOURCE FILE] [FUNCTIONS, ...]",
+	Short: "Create benchmark skeletons for functions",
+	Long: `Mkbench reads a rust source file in the src directory of a crate and
+	writes benchmarks for its public functions to benches/<module>.rs. Name
+	functions after the file to benchmark only those, ie. parse or
+	Parser::next. All public functions are benchmarked otherwise.
+
+	By default the benchmarks are a Criterion group, and the [[bench]] target
+	and the criterion dev-dependency are added to Cargo.toml. With --nightly
+	they use #[bench] from the unstable test crate instead, which needs no
+	dependency.
+
+	Each benchmark sets up its inputs with Default::default(), which must be
+	replaced wherever a type has no default or a default is not a meaningful
+	input. Async functions are skipped.`,
+	Args: cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		err := makeBench(args[0], args[1:])
+		if err != nil {
+			fmt.Println(err)
+		}
+	},
+}
+
+var nightly bool
+var criterionVersion string
+
+func init() {
+	rootCmd.AddCommand(mkbenchCmd)
+	mkbenchCmd.Flags().BoolVar(&nightly, "nightly", false, "Use #[bench] from the nightly test crate instead of Criterion")
+	mkbenchCmd.Flags().StringVar(&criterionVersion, "criterion", "0.5", "Version of criterion to add to the dev-dependencies")
+}
+
+const mkbenchTemplate = `{{if nightly}}#![feature(test)]
+extern crate test;
+
+use {{.Path}}::*;
+use test::{black_box, Bencher};
+{{range .Fns}}
+#[bench]
+fn {{benchName .}}(b: &mut Bencher) {
+	{{template "setup" .}}b.iter(|| {{benchCall .}});
+}
+{{end}}{{else}}use criterion::{black_box, criterion_group, criterion_main, Criterion};
+use {{.Path}}::*;
+
+fn {{.Group}}(c: &mut Criterion) {
+	let mut group = c.benchmark_group("{{.Name}}");
+{{range .Fns}}	group.bench_function("{{displayName .}}", |b| {
+		{{template "setup" .}}b.iter(|| {{benchCall .}})
+	});
+{{end}}	group.finish();
+}
+
+criterion_group!(benches, {{.Group}});
+criterion_main!(benches);
+{{end}}{{define "setup"}}{{if benchInputs .}}// FIXME: set up meaningful inputs
+	{{if not nightly}}	{{end}}{{end}}{{range benchInputs .}}let {{index . 0}}: {{index . 1}} = Default::default();
+	{{if not nightly}}	{{end}}{{end}}{{if .Fn.Unsafe}}// SAFETY: FIXME explain how the safety requirements are met
+	{{if not nightly}}	{{end}}{{end}}{{end}}`
+
+// benchFile is the data for the benchmark template
+type benchFile struct {
+	Path  string // of the module, ie. mycrate::net
+	Name  string // of the benchmark target
+	Group string // function registering the benchmarks with Criterion
+	Fns   []qualified
+}
+
+func makeBench(fname string, selected []string) error {
+	fmap := template.FuncMap{
+		"nightly":     func() bool { return nightly },
+		"benchName":   benchName,
+		"benchCall":   benchCall,
+		"benchInputs": propInputs,
+		"displayName": displayName,
+	}
+	benchTemp := template.Must(template.New("benchTemp").Funcs(fmap).Parse(mkbenchTemplate))
+
+	f, err := os.Open(fname)
+	if err != nil {
+		return fmt.Errorf("File Read error: %v", err)
+	}
+	source, err := rust.Parse(f)
+	f.Close()
+	if err != nil {
+		return fmt.Errorf("Parsing error: %v", err)
+	}
+	root, path, err := crateModule(fname)
+	if err != nil {
+		return err
+	}
+	fns := benchable(publicOnly(source), selected)
+	if len(fns) == 0 {
+		return errors.New("no public functions to benchmark in " + fname)
+	}
+	name := lastSegment(path)
+	dest := filepath.Join(root, "benches", name+".rs")
+	if _, err := os.Stat(dest); err == nil {
+		return errors.New(dest + " already exists")
+	}
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return err
+	}
+	destination, err := os.Create(dest)
+	if err != nil {
+		return fmt.Errorf("Unable to create file: %v", err)
+	}
+	defer destination.Close()
+	data := benchFile{Path: path, Name: name, Group: "bench_" + name, Fns: fns}
+	if err := benchTemp.Execute(destination, data); err != nil {
+		return fmt.Errorf("Template error: %v", err)
+	}
+	if nightly {
+		return nil
+	}
+	if err := addTarget(root, "bench", name, "harness = false"); err != nil {
+		return err
+	}
+	return addDevDependency(root, "criterion", criterionVersion)
+}
+
+// benchable lists the functions of src to benchmark. When functions are
+// selected by name, ie. parse or Parser::parse, only those are given.
+func benchable(src rust.Source, selected []string) []qualified {
+	var fns []qualified
+	for _, q := range testable(src) {
+		if q.Fn.Async {
+			fmt.Println("Skipping async function", displayName(q))
+			continue
+		}
+		if len(selected) == 0 {
+			fns = append(fns, q)
+			continue
+		}
+		for _, s := range selected {
+			if s == displayName(q) {
+				fns = append(fns, q)
+				break
+			}
+		}
+	}
+	return fns
+}
+
+// benchName gives the name of a #[bench] function, ie. bench_Parser_parse
+func benchName(q qualified) string {
+	return "bench_" + strings.TrimPrefix(testName(q), "test_")
+}
+
+// benchCall gives the expression measured by a benchmark. Arguments pass
+// through black_box so the call is not optimized away, and values which are
+// consumed by the call are cloned for each iteration.
+func benchCall(q qualified) string {
+	var args []string
+	for _, a := range skipSelf(q.Fn.Args) {
+		name := stripType(a)
+		if name == "" {
+			continue
+		}
+		t := argType(a)
+		switch {
+		case borrowOf(t) != "":
+			name = borrowOf(t) + name
+		case !copyable(ownedType(t)):
+			name += ".clone()"
+		}
+		args = append(args, "black_box("+name+")")
+	}
+	obj := "obj"
+	if r := receiver(q.Fn.Args); r == "value" || r == "typed" {
+		obj = "obj.clone()"
+	}
+	return callWith(q, obj, strings.Join(args, ", "))
+}
@@ -0,0 +1,267 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/skreimeyer/rustbuddy/rust"
+	"github.com/spf13/cobra"
+)
+
+// mkdocCmd represents the mkdoc command
+var mkdocCmd = &cobra.Command{
+	Use:   "mkdoc [FLAGS] [SOURCE FILES]",
+	Short: "Add doctest examples to public functions",
+	Long: `Mkdoc finds the public functions and methods of rust source files in the
+	src directory of a crate whose documentation has no "# Examples" section.
+	Each one gets an Examples section with a doctest which imports the item by
+	its crate path, sets up placeholder arguments derived from the parameter
+	types and calls it:
+
+	/// # Examples
+	///
+	/// ` + "```" + `
+	/// use mycrate::geo::area;
+	///
+	/// // FIXME: replace the placeholder values
+	/// let w: u32 = 1;
+	/// let h: u32 = 1;
+	/// let result = area(w, h);
+	/// // FIXME: check the result, ie. assert_eq!(result, ...);
+	/// ` + "```" + `
+
+	The section is added after any existing documentation. Source files are
+	changed in place unless --dry-run is given, which prints the sections
+	instead. Async functions are skipped.`,
+	Args: cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		makeDoc(args)
+	},
+}
+
+var dryRun bool
+
+func init() {
+	rootCmd.AddCommand(mkdocCmd)
+	mkdocCmd.Flags().BoolVar(&dryRun, "dry-run", false, "Print the examples instead of changing the source files")
+}
+
+const mkdocTemplate = `# Examples
+
+` + "```" + `
+use {{.Path}}::{{.Import}};
+
+{{with .Inputs}}// FIXME: replace the placeholder values
+{{range .}}let {{index . 0}}: {{index . 1}} = {{placeholder (index . 1)}};
+{{end}}{{end}}{{if .Unsafe}}// SAFETY: FIXME explain how the safety requirements are met
+{{end}}{{if .Result}}let result = {{.Call}};
+// FIXME: check the result, ie. assert_eq!(result, ...);{{else}}{{.Call}};{{end}}
+` + "```"
+
+// example is the data for the doctest of one function
+type example struct {
+	Path   string // of the module, ie. mycrate::net
+	Import string // the function or the type of the method
+	Inputs [][2]string
+	Call   string
+	Result bool
+	Unsafe bool
+}
+
+func makeDoc(args []string) {
+	fmap := template.FuncMap{
+		"placeholder": placeholder,
+	}
+	docTemp := template.Must(template.New("docTemp").Funcs(fmap).Parse(mkdocTemplate))
+	for _, fname := range args {
+		f, err := os.Open(fname)
+		if err != nil {
+			fmt.Println("File Read error:", err)
+			continue
+		}
+		source, err := rust.Parse(f)
+		f.Close()
+		if err != nil {
+			fmt.Println("Parsing error:", err)
+			continue
+		}
+		_, path, err := crateModule(fname)
+		if err != nil {
+			fmt.Println(err)
+			continue
+		}
+		content, err := ioutil.ReadFile(fname)
+		if err != nil {
+			fmt.Println("File Read error:", err)
+			continue
+		}
+		lines := strings.Split(string(content), "\n")
+		inserts := make(map[int][]string) // lines to add before each line
+		for _, q := range undocumented(source) {
+			var doc bytes.Buffer
+			if err := docTemp.Execute(&doc, newExample(path, q)); err != nil {
+				fmt.Println("Template error:", err)
+				continue
+			}
+			at, indent := docPosition(lines, q.Fn.Span.Start.Line-1)
+			var block []string
+			if q.Fn.Doc != "" {
+				block = append(block, indent+"///")
+			}
+			for _, l := range strings.Split(doc.String(), "\n") {
+				block = append(block, strings.TrimRight(indent+"/// "+l, " "))
+			}
+			if dryRun {
+				fmt.Printf("%s:%d %s\n%s\n\n", fname, at+1, displayName(q), strings.Join(block, "\n"))
+				continue
+			}
+			inserts[at] = append(inserts[at], block...)
+		}
+		if dryRun || len(inserts) == 0 {
+			continue
+		}
+		err = ioutil.WriteFile(fname, []byte(strings.Join(insertLines(lines, inserts), "\n")), 0644)
+		if err != nil {
+			fmt.Println("Cannot write to source file:", err)
+			continue
+		}
+		fmt.Println("Added examples to", len(inserts), "functions in", fname)
+	}
+}
+
+// undocumented lists the public functions and methods of src without an
+// Examples section in their documentation
+func undocumented(src rust.Source) []qualified {
+	var fns []qualified
+	for _, f := range src.Funcs {
+		if f.Public && !f.Async && !hasExamples(f.Doc) {
+			fns = append(fns, qualify("", "", f))
+		}
+	}
+	for _, s := range src.RsStructs {
+		for _, f := range s.Methods {
+			if f.Public && !f.Async && !hasExamples(f.Doc) {
+				fns = append(fns, qualify(s.Name, "", f))
+			}
+		}
+	}
+	return fns
+}
+
+// hasExamples reports whether a doc comment has an Examples section
+func hasExamples(doc string) bool {
+	for _, l := range strings.Split(doc, "\n") {
+		l = strings.TrimSpace(l)
+		if l == "# Examples" || l == "# Example" {
+			return true
+		}
+	}
+	return false
+}
+
+// newExample sets up the doctest of a function in the module at path
+func newExample(path string, q qualified) example {
+	ex := example{Path: path, Import: q.Fn.Name, Result: strings.TrimSpace(q.Fn.Return) != "", Unsafe: q.Fn.Unsafe}
+	obj := ""
+	if q.Type != "" {
+		ex.Import = q.Type
+		obj = strings.ToLower(rust.BaseName(q.Type))
+	}
+	for _, in := range propInputs(q) {
+		switch in[0] {
+		case "obj":
+			in[0] = obj
+		case "mut obj":
+			in[0] = "mut " + obj
+		}
+		ex.Inputs = append(ex.Inputs, in)
+	}
+	var args []string
+	for _, a := range skipSelf(q.Fn.Args) {
+		if name := stripType(a); name != "" {
+			args = append(args, borrowOf(argType(a))+name)
+		}
+	}
+	ex.Call = callWith(q, obj, strings.Join(args, ", "))
+	return ex
+}
+
+// docPosition finds the line before which the examples of the item starting
+// at line i go, which is above its attributes, and the indentation of the
+// item.
+func docPosition(lines []string, i int) (int, string) {
+	indent := lines[i][:len(lines[i])-len(strings.TrimLeft(lines[i], " \t"))]
+	for i > 0 && strings.HasPrefix(strings.TrimSpace(lines[i-1]), "#[") {
+		i--
+	}
+	return i, indent
+}
+
+// insertLines adds the inserts before the lines they are keyed by
+func insertLines(lines []string, inserts map[int][]string) []string {
+	var at []int
+	for i := range inserts {
+		at = append(at, i)
+	}
+	sort.Ints(at)
+	var result []string
+	last := 0
+	for _, i := range at {
+		result = append(result, lines[last:i]...)
+		result = append(result, inserts[i]...)
+		last = i
+	}
+	return append(result, lines[last:]...)
+}
+
+// placeholder gives a literal value of type t for an example
+func placeholder(t string) string {
+	t = strings.TrimSpace(t)
+	if strings.HasPrefix(t, "(") && strings.HasSuffix(t, ")") {
+		var elems []string
+		for _, e := range rust.SplitTop(t[1:len(t)-1], ',') {
+			if e = strings.TrimSpace(e); e != "" {
+				elems = append(elems, placeholder(e))
+			}
+		}
+		if len(elems) == 1 {
+			return "(" + elems[0] + ",)"
+		}
+		return "(" + strings.Join(elems, ", ") + ")"
+	}
+	head, args := rust.SplitGeneric(t)
+	switch rust.BaseName(head) {
+	case "i8", "i16", "i32", "i64", "i128", "isize", "u8", "u16", "u32", "u64", "u128", "usize":
+		return "1"
+	case "f32", "f64":
+		return "1.0"
+	case "bool":
+		return "true"
+	case "char":
+		return "'a'"
+	case "String":
+		return `String::from("example")`
+	case "PathBuf":
+		return `std::path::PathBuf::from("example")`
+	case "OsString":
+		return `std::ffi::OsString::from("example")`
+	}
+	// containers only hold a placeholder of their argument when it is written
+	// out, ie. not for a local struct Box;
+	if len(args) == 1 {
+		switch rust.BaseName(head) {
+		case "Vec":
+			return "vec![" + placeholder(args[0]) + "]"
+		case "Option":
+			return "Some(" + placeholder(args[0]) + ")"
+		case "Box":
+			return "Box::new(" + placeholder(args[0]) + ")"
+		}
+	}
+	return "Default::default()"
+}
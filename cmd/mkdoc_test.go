@@ -0,0 +1,22 @@
+package cmd
+
+import "testing"
+
+func TestPlaceholder(t *testing.T) {
+	cases := []struct{ t, want string }{
+		{"u8", "1"},
+		{"String", `String::from("example")`},
+		{"Vec<f64>", "vec![1.0]"},
+		{"Option<Box<char>>", "Some(Box::new('a'))"},
+		{"(bool, String)", `(true, String::from("example"))`},
+		// local types sharing the name of a container
+		{"Box", "Default::default()"},
+		{"Vec", "Default::default()"},
+		{"Option", "Default::default()"},
+	}
+	for _, c := range cases {
+		if got := placeholder(c.t); got != c.want {
+			t.Errorf("placeholder(%q) = %s, want %s", c.t, got, c.want)
+		}
+	}
+}
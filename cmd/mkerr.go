@@ -18,26 +18,73 @@ along with this program. If not, see <http://www.gnu.org/licenses/>.
 package cmd
 
 import (
-	"bufio"
 	"bytes"
+	"errors"
 	"fmt"
-	"html/template"
+	"io"
 	"io/ioutil"
 	"os"
-	"path"
+	"path/filepath"
+	"regexp"
 	"strings"
+	"text/scanner"
 
+	"github.com/skreimeyer/rustbuddy/rust"
 	"github.com/spf13/cobra"
 )
 
 var mkerrCmd = &cobra.Command{
 	Use:   "mkerr [flags]",
 	Short: "Generate a custom error for a single file",
-	Long: `mkerr uses the file or module name to template out a custom error
-	identical to that shown in the "Defining and Error Type" from the
-	Rust by Example book. w written to stdout by default`,
+	Long: `mkerr uses the file or module name to template out a custom error enum.
+	Errors the file already returns, or propagates with ? from calls such as
+	File::open or str::parse::<i32>, each get a variant wrapping them, ie.
+	Io { source: std::io::Error }, with a From implementation so that ?
+	converts them and source() giving the wrapped error. An Other variant
+	carries messages. The error is named after the module in UpperCamelCase,
+	ie. ParserError for src/parser.rs or src/parser/mod.rs, or after the
+	crate for lib.rs and main.rs. --name gives it another name, which must be
+	a rust identifier.
+
+	The error goes after the inner attributes, extern crates and use
+	declarations at the top of the file. The result is written to stdout by
+	default, or in place with --write. With --module the error is written to
+	its own module instead, error.rs beside lib.rs, main.rs or mod.rs and
+	other/error.rs for other.rs, and the file gets the declarations
+	mod error; and pub use error::{Error, Result};.
+
+	The error is public and #[non_exhaustive], and comes with an alias
+	Result<T, E = Error> unless the file has a Result of its own. --style
+	picks how it is implemented: by hand with std only, or with the derives
+	of thiserror or snafu, which are added to the dependencies of the crate
+	when writing in place. --backtrace adds a std::backtrace::Backtrace to
+	each variant, captured where the error is created. thiserror only
+	supports backtraces on nightly, so --backtrace takes the hand or snafu
+	style.
+
+	--migrate moves the functions of the file over to the error. Those
+	returning Result<T, Box<dyn Error>> or Result<T, String> return
+	Result<T, Error> instead, and errors they create from strings, ie.
+	Err("bad input".into()), Err(format!(...)) or .ok_or("missing"), are
+	made with Error::new. Methods of trait impls and main are left alone.
+	The error converts from String and &str, so that String errors which are
+	still propagated with ?, ie. .map_err(|e| e.to_string())?, become Other.`,
 	Args: cobra.ExactArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
+		if _, ok := errStyles[errStyle]; !ok {
+			fmt.Println("Unknown style", errStyle, "- use hand, thiserror or snafu")
+			return
+		}
+		if backtrace && errStyle == "thiserror" {
+			fmt.Println("thiserror needs a nightly compiler for backtraces - use --style hand or snafu with --backtrace")
+			return
+		}
+		if name == "" {
+			name = makeName(args[0]) + "Error"
+		} else if !isIdentifier(name) {
+			fmt.Println("Invalid name", name, "- the error needs a rust identifier, ie. ParseError")
+			return
+		}
 		dest := ""
 		src, err := os.Open(args[0])
 		if err != nil {
@@ -47,118 +94,345 @@ var mkerrCmd = &cobra.Command{
 		if writeout == true {
 			dest = args[0]
 		}
-		if name == "" {
-			name = makeName(args[0]) + "Error"
-		}
 		makeErr(name, src, dest)
 	},
 }
 
 var writeout bool
 var name string
+var errStyle string
+var backtrace bool
+var errModule bool
+var migrateErrs bool
+
+// errStyles are the values of --style, with the crate each one depends on
+var errStyles = map[string][2]string{
+	"hand":      {},
+	"thiserror": {"thiserror", "2"},
+	"snafu":     {"snafu", "0.8"},
+}
+
+// ownResult matches a Result declared or imported by the source file, which
+// the alias declared by mkerr would clash with
+var ownResult = regexp.MustCompile(`(?m)^\s*(pub(\([^)]*\))?\s+)?(type\s+Result\b|use\s[^;]*\bResult\s*[;},])`)
 
 func init() {
 	rootCmd.AddCommand(mkerrCmd)
 	mkerrCmd.Flags().BoolVar(&writeout, "write", false, "write w in place of the existing file")
-	mkerrCmd.Flags().StringVar(&name, "name", "", "name for custom error. Defaults to module name.")
+	mkerrCmd.Flags().StringVar(&name, "name", "", "name for custom error. Defaults to the module name in UpperCamelCase, ie. ParserError.")
+	mkerrCmd.Flags().StringVar(&errStyle, "style", "hand", "Implementation of the error: hand, thiserror or snafu")
+	mkerrCmd.Flags().BoolVar(&backtrace, "backtrace", false, "Capture a backtrace where errors are created")
+	mkerrCmd.Flags().BoolVar(&errModule, "module", false, "Write the error to the module error and re-export it from the file")
+	mkerrCmd.Flags().BoolVar(&migrateErrs, "migrate", false, "Make functions returning Box<dyn Error> or String errors return the error")
 }
 
-// Templates a typical error declaration block. Uses bufio scanner because we
-// actually need the content of comment lines, so we're not omitting any of the
-// content of the original file.
-func makeErr(errName string, source *os.File, outFile string) {
-	const eTmpl = `
-use std::error::Error;
-use std::fmt;
-
+// mkerrTemplate is the default template of mkerr, executed with a customErr
+const mkerrTemplate = `{{if eq .Style "thiserror"}}{{template "thiserror" .}}{{else if eq .Style "snafu"}}{{template "snafu" .}}{{else}}{{template "hand" .}}{{end}}{{if .Migrate}}{{template "fromString" .}}{{end}}
+{{define "hand"}}
 #[derive(Debug)]
-struct {{.E}} {
-    message: String
+#[non_exhaustive]
+pub enum {{.E}} {
+{{range .Variants}}    {{.Name}} {
+        source: {{.Type}},{{if $.Backtrace}}
+        backtrace: std::backtrace::Backtrace,{{end}}
+    },
+{{end}}    Other {
+        message: String,{{if .Backtrace}}
+        backtrace: std::backtrace::Backtrace,{{end}}
+    },
 }
-
+{{template "alias" .}}
 impl {{.E}} {
-    fn new(message: &str) -> {{.E}} {
-        {{.E}}{message: message.to_string()}
+    pub fn new(message: &str) -> Self {
+        {{.E}}::Other {
+            message: message.to_string(),{{if .Backtrace}}
+            backtrace: std::backtrace::Backtrace::capture(),{{end}}
+        }
+    }{{if .Backtrace}}
+
+    /// The backtrace captured where the error was created, which is empty
+    /// unless RUST_BACKTRACE or RUST_LIB_BACKTRACE is set
+    pub fn backtrace(&self) -> &std::backtrace::Backtrace {
+        match self {
+{{range .Variants}}            {{$.E}}::{{.Name}} { backtrace, .. } => backtrace,
+{{end}}            {{.E}}::Other { backtrace, .. } => backtrace,
+        }
+    }{{end}}
+}
+
+impl std::fmt::Display for {{.E}} {
+    fn fmt(&self, f: &mut std::fmt::Formatter<'_>) -> std::fmt::Result {
+        match self {
+{{range .Variants}}            {{$.E}}::{{.Name}} { source, .. } => write!(f, "{{lowerWords .Name}} error: {}", source),
+{{end}}            {{.E}}::Other { message, .. } => f.write_str(message),
+        }
     }
 }
 
-impl fmt::Display for {{.E}} {
-    fn fmt(&self, f: &mut fmt::Formatter) -> fmt::Result {
-        write!(f,"{}",self.message)
+impl std::error::Error for {{.E}} {
+    fn source(&self) -> Option<&(dyn std::error::Error + 'static)> {
+        match self {
+{{range .Variants}}            {{$.E}}::{{.Name}} { source, .. } => Some(source),
+{{end}}            {{.E}}::Other { .. } => None,
+        }
+    }
+}
+{{range .Variants}}
+impl From<{{.Type}}> for {{$.E}} {
+    fn from(source: {{.Type}}) -> Self {
+        {{$.E}}::{{.Name}} {
+            source,{{if $.Backtrace}}
+            backtrace: std::backtrace::Backtrace::capture(),{{end}}
+        }
+    }
+}
+{{end}}{{end}}{{define "thiserror"}}
+#[derive(Debug, thiserror::Error)]
+#[non_exhaustive]
+pub enum {{.E}} {
+{{range .Variants}}    #[error("{{lowerWords .Name}} error: {source}")]
+    {{.Name}} {
+        #[from]
+        source: {{.Type}},
+    },
+{{end}}    #[error("{message}")]
+    Other {
+        message: String,
+    },
+}
+{{template "alias" .}}
+impl {{.E}} {
+    pub fn new(message: &str) -> Self {
+        {{.E}}::Other {
+            message: message.to_string(),
+        }
+    }
+}
+{{end}}{{define "snafu"}}
+#[derive(Debug, snafu::Snafu)]
+#[non_exhaustive]
+pub enum {{.E}} {
+{{range .Variants}}    #[snafu(display("{{lowerWords .Name}} error: {source}"), context(false))]
+    {{.Name}} {
+        source: {{.Type}},{{if $.Backtrace}}
+        backtrace: snafu::Backtrace,{{end}}
+    },
+{{end}}    #[snafu(display("{message}"))]
+    Other {
+        message: String,{{if .Backtrace}}
+        backtrace: snafu::Backtrace,{{end}}
+    },
+}
+{{template "alias" .}}
+impl {{.E}} {
+    pub fn new(message: &str) -> Self {
+        OtherSnafu { message }.build()
+    }
+}
+{{end}}{{define "fromString"}}
+impl From<String> for {{.E}} {
+    fn from(message: String) -> Self {
+        {{.E}}::new(&message)
     }
 }
 
-impl Error for {{.E}} {
-    fn description(&self) -> &str {
-        &self.message
+impl From<&str> for {{.E}} {
+    fn from(message: &str) -> Self {
+        {{.E}}::new(message)
     }
 }
+{{end}}{{define "alias"}}{{if .Alias}}
+/// Result of the operations of this module
+pub type Result<T, E = {{.E}}> = std::result::Result<T, E>;
+{{end}}{{end}}`
 
-`
-	eTemp := template.Must(template.New("eTemp").Parse(eTmpl))
+// customErr is given to the mkerr template. E is the name of the error type,
+// Variants wrap the errors propagated in Source, the parsed file the error is
+// added to. Alias is false when the file already has a Result of its own.
+// Migrate is set when functions are migrated to the error, which then
+// converts from the String errors they propagate.
+type customErr struct {
+	E         string
+	Variants  []errVariant
+	Source    rust.Source
+	Style     string // hand, thiserror or snafu
+	Backtrace bool
+	Alias     bool // whether to declare a Result alias
+	Migrate   bool
+}
 
-	type customErr struct {
-		E string
+// Templates a typical error declaration block. It goes after the header of
+// the file, its inner attributes and use declarations, or into a module of
+// its own with --module.
+func makeErr(errName string, source *os.File, outFile string) {
+	defer source.Close()
+	eTemp, err := loadTemplate("mkerr", source.Name())
+	if err != nil {
+		fmt.Println("Failed to load error template:", err)
+		return
+	}
+	src, err := rust.Parse(source)
+	if err != nil {
+		fmt.Println("Cannot parse", source.Name(), err)
+		return
+	}
+	source.Seek(0, io.SeekStart)
+	content, err := ioutil.ReadAll(source)
+	if err != nil {
+		fmt.Println("File Read error:", err)
+		return
+	}
+	if migrateErrs {
+		content = migrate(content, src, errName)
+	}
+	ce := customErr{
+		E:         errName,
+		Source:    src,
+		Variants:  propagatedErrors(src, errName),
+		Style:     errStyle,
+		Backtrace: backtrace,
+		Alias:     errModule || !ownResult.Match(content),
+		Migrate:   migrateErrs,
 	}
-	ce := customErr{E: errName}
-	writeComplete := false
-	scn := bufio.NewScanner(source)
 	var b bytes.Buffer
-	for scn.Scan() {
-		if strings.HasPrefix(scn.Text(), "//") {
-			b.Write(scn.Bytes())
-			b.Write([]byte("\n"))
-			continue
-		}
-		if strings.HasPrefix(scn.Text(), "/*") {
-			b.Write(scn.Bytes())
-			b.Write([]byte{'\n'}) // avoid trimming newline
-			for {
-				scn.Scan()
-				b.Write(scn.Bytes())
-				b.Write([]byte("\n"))
-				if strings.Contains(scn.Text(), "*/") {
-					scn.Scan() // so we don't catch the trailing slash
-					break
-				}
-			}
+	if err := eTemp.Execute(&b, ce); err != nil {
+		fmt.Println("Failed to write error template:", err)
+		return
+	}
+	if errModule {
+		if err := writeErrModule(source.Name(), content, src.Header, ce, b.String()); err != nil {
+			fmt.Println(err)
 		}
-		if writeComplete == false {
-			err := eTemp.Execute(&b, ce)
-			writeComplete = true
-			if err != nil {
-				fmt.Println("Failed to write error template:", err)
+		return
+	}
+	result := insertHeader(content, src.Header, b.String())
+	if outFile == "" {
+		os.Stdout.Write(result)
+		return
+	}
+	if err := ioutil.WriteFile(outFile, result, 0644); err != nil {
+		fmt.Println("Cannot write to source file:", err)
+		return
+	}
+	addErrDependency(outFile)
+}
+
+// writeErrModule writes the error to the module error beside the source file
+// fname and declares it in the source, re-exporting the error.
+func writeErrModule(fname string, content []byte, header scanner.Position, ce customErr, decl string) error {
+	if declaresError.Match(content) {
+		return errors.New(fname + " already has a module named error")
+	}
+	dest := errModulePath(fname)
+	if _, err := os.Stat(dest); err == nil {
+		return errors.New(dest + " already exists")
+	}
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(dest, []byte(strings.TrimLeft(decl, "\n")), 0644); err != nil {
+		return err
+	}
+	export := ce.E
+	if !ownResult.Match(content) {
+		export = "{" + ce.E + ", Result}"
+	}
+	wiring := "mod error;\npub use error::" + export + ";\n"
+	if err := ioutil.WriteFile(fname, insertHeader(content, header, wiring), 0644); err != nil {
+		return fmt.Errorf("Cannot write to source file: %v", err)
+	}
+	fmt.Println("Wrote", dest)
+	addErrDependency(fname)
+	return nil
+}
+
+// declaresError matches the declaration of a module named error
+var declaresError = regexp.MustCompile(`(?m)^\s*(pub(\([^)]*\))?\s+)?mod\s+error\b`)
+
+// errModulePath gives the file of the module error of the source file fname.
+// Modules of lib.rs, main.rs and mod.rs are beside them, while those of
+// other.rs go in the directory other.
+func errModulePath(fname string) string {
+	dir, base := filepath.Split(fname)
+	switch base {
+	case "lib.rs", "main.rs", "mod.rs":
+		return filepath.Join(dir, "error.rs")
+	}
+	return filepath.Join(dir, strings.TrimSuffix(base, ".rs"), "error.rs")
+}
+
+// insertHeader adds text to content after the header of the file, with a
+// blank line around it. A comment ending the line of the header stays with
+// it.
+func insertHeader(content []byte, header scanner.Position, text string) []byte {
+	at := header.Offset
+	if at > 0 {
+		rest := content[at:]
+		if i := bytes.IndexByte(rest, '\n'); i != -1 {
+			line := bytes.TrimSpace(rest[:i])
+			if len(line) == 0 || bytes.HasPrefix(line, []byte("//")) {
+				at += i
 			}
 		}
-		b.Write(scn.Bytes())
-		b.Write([]byte("\n"))
 	}
-	source.Close()
-	if outFile != "" {
-		ioutil.WriteFile(outFile, b.Bytes(), 0644)
-	} else {
-		os.Stdout.Write(b.Bytes())
+	var b bytes.Buffer
+	if head := bytes.TrimRight(content[:at], " \t\r\n"); len(head) > 0 {
+		b.Write(head)
+		b.WriteString("\n\n")
+	}
+	b.WriteString(strings.Trim(text, "\n"))
+	b.WriteString("\n")
+	if tail := bytes.TrimLeft(content[at:], "\r\n"); len(tail) > 0 {
+		b.WriteString("\n")
+		b.Write(tail)
+	}
+	return b.Bytes()
+}
 
+// addErrDependency adds the crate implementing the error with --style to the
+// dependencies of the crate of fname
+func addErrDependency(fname string) {
+	dep := errStyles[errStyle]
+	if dep[0] == "" {
+		return
+	}
+	root, err := findCrate(filepath.Dir(fname))
+	if err != nil {
+		return
+	}
+	if err := addDependency(root, "dependencies", dep[0], dep[1]); err != nil {
+		fmt.Println(err)
 	}
 }
 
+// makeName gives the name of the module of the source file fname as a type,
+// ie. Parser for src/parser.rs or src/parser/mod.rs. The root module, lib.rs
+// or main.rs, is named after the crate.
 func makeName(fname string) string {
-	result := path.Base(fname)
-	if result == "mod.rs" {
-		dir, _ := path.Split(fname)
-		if dir == "" { // User supplied a file mod.rs in working dir
-			wd, err := os.Getwd()
-			if err != nil {
-				result = "Custom"
-			} else {
-				result = path.Base(wd)
-			}
-		} else {
-			dir = strings.Trim(dir, "/") // remove trailing slash
-			i := strings.LastIndex(dir, "/")
-			result = dir[i+1:]
-		}
+	module := ""
+	if _, path, err := crateModule(fname); err == nil {
+		module = lastSegment(path)
+	} else {
+		module = fileModule(fname)
+	}
+	result := upperCamel(strings.TrimPrefix(module, "r#"))
+	if !isIdentifier(result) {
+		return "Custom"
+	}
+	return result
+}
 
+// fileModule gives the name of the module of a source file outside of a
+// crate, which is the name of the directory for mod.rs, lib.rs and main.rs
+// and skips over a src directory.
+func fileModule(fname string) string {
+	abs, err := filepath.Abs(fname)
+	if err != nil {
+		abs = fname
+	}
+	module, dir := strings.TrimSuffix(filepath.Base(abs), ".rs"), filepath.Dir(abs)
+	for (module == "mod" || module == "lib" || module == "main" || module == "src") && dir != filepath.Dir(dir) {
+		module, dir = filepath.Base(dir), filepath.Dir(dir)
 	}
-	return strings.TrimRight(result, ".rs")
+	return module
 }
@@ -0,0 +1,39 @@
+package cmd
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMakeName(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mkerr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	root := tempCrate(t, "src/lib.rs", "src/parser.rs", "src/parser/mod.rs", "src/net/http_client.rs")
+	defer os.RemoveAll(root)
+	cases := []struct{ fname, want string }{
+		// outside of a crate the file is named by its stem
+		{filepath.Join(dir, "parser.rs"), "Parser"},
+		{filepath.Join(dir, "user.rs"), "User"},
+		{filepath.Join(dir, "items.rs"), "Items"},
+		{filepath.Join(dir, "http_client.rs"), "HttpClient"},
+		{filepath.Join(dir, "net", "mod.rs"), "Net"},
+		{filepath.Join(dir, "my_tool", "src", "lib.rs"), "MyTool"},
+		{filepath.Join(dir, "my_tool", "src", "main.rs"), "MyTool"},
+		{filepath.Join(dir, "2fa.rs"), "Custom"},
+		// inside a crate the module path is used
+		{filepath.Join(root, "src", "parser.rs"), "Parser"},
+		{filepath.Join(root, "src", "parser", "mod.rs"), "Parser"},
+		{filepath.Join(root, "src", "net", "http_client.rs"), "HttpClient"},
+		{filepath.Join(root, "src", "lib.rs"), "MyCrate"},
+	}
+	for _, c := range cases {
+		if got := makeName(c.fname); got != c.want {
+			t.Errorf("makeName(%q) = %q, want %q", c.fname, got, c.want)
+		}
+	}
+}
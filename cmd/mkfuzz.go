@@ -0,0 +1,249 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"github.com/skreimeyer/rustbuddy/rust"
+	"github.com/spf13/cobra"
+)
+
+// mkfuzzCmd represents the mkfuzz command
+var mkfuzzCmd = &cobra.Command{
+	Use:   "mkfuzz [SOURCE FILE] [FUNCTION]",
+	Short: "Create a cargo-fuzz target for a function",
+	Long: `Mkfuzz writes a libFuzzer harness for a public function of a crate to
+	fuzz/fuzz_targets/<function>.rs, to be run with cargo fuzz. Methods are
+	named by their type, ie. Parser::parse, and get the target Parser_parse.
+
+	Functions taking only a &[u8] get the raw input, and functions taking only
+	a &str get the input when it is valid UTF-8. Otherwise the input is
+	decoded into the owned types of the parameters with the arbitrary crate.
+	Types of the crate must implement arbitrary::Arbitrary for this, ie. with
+	#[derive(arbitrary::Arbitrary)], which the harness points out.
+
+	The fuzz crate in fuzz/ is created if it is missing, and the target is
+	added to its Cargo.toml.`,
+	Args: cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		err := makeFuzz(args[0], args[1])
+		if err != nil {
+			fmt.Println(err)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(mkfuzzCmd)
+}
+
+const fuzzTemplate = `#![no_main]
+
+use libfuzzer_sys::fuzz_target;
+use {{.Path}}::{{.Import}};{{with .TraitUse}}
+{{.}}{{end}}
+
+{{range .Missing}}// FIXME: {{.}} needs an implementation of arbitrary::Arbitrary
+{{end}}fuzz_target!(|{{.Param}}| {
+{{range .Setup}}	{{.}}
+{{end}}{{if .Unsafe}}	// SAFETY: FIXME explain how the safety requirements are met
+{{end}}	let _ = {{.Call}};
+});
+`
+
+const fuzzManifest = `[package]
+name = "{{.Package}}-fuzz"
+version = "0.0.0"
+publish = false
+edition = "2021"
+
+[package.metadata]
+cargo-fuzz = true
+
+[dependencies]
+libfuzzer-sys = "0.4"
+arbitrary = { version = "1", features = ["derive"] }
+
+[dependencies.{{.Package}}]
+path = ".."
+`
+
+// harness is the data for a fuzz target
+type harness struct {
+	Path     string // of the module, ie. mycrate::net
+	Import   string // the function or the type of the method
+	TraitUse string // use declaration of the trait of the method, if needed
+	Package  string
+	Param    string // of the closure given to fuzz_target!
+	Setup    []string
+	Call     string
+	Missing  []string // types without an implementation of Arbitrary
+	Unsafe   bool
+}
+
+func makeFuzz(fname, function string) error {
+	f, err := os.Open(fname)
+	if err != nil {
+		return fmt.Errorf("File Read error: %v", err)
+	}
+	source, err := rust.Parse(f)
+	f.Close()
+	if err != nil {
+		return fmt.Errorf("Parsing error: %v", err)
+	}
+	arbitrary = derivesOf(source, "Arbitrary")
+	var target qualified
+	for _, q := range testable(publicOnly(source)) {
+		if displayName(q) == function {
+			target = q
+			break
+		}
+	}
+	if target.Fn.Name == "" {
+		return errors.New("cannot find public function " + function + " in " + fname)
+	}
+	if target.Fn.Async {
+		return errors.New("cannot fuzz async function " + function)
+	}
+	root, path, err := crateModule(fname)
+	if err != nil {
+		return err
+	}
+	pkg, err := packageName(root)
+	if err != nil {
+		return err
+	}
+	h := newHarness(target)
+	h.Path, h.Package = path, pkg
+	h.TraitUse = traitUse(source, path, target.Trait)
+
+	fuzzDir := filepath.Join(root, "fuzz")
+	name := strings.TrimPrefix(testName(target), "test_")
+	dest := filepath.Join(fuzzDir, "fuzz_targets", name+".rs")
+	if _, err := os.Stat(dest); err == nil {
+		return errors.New(dest + " already exists")
+	}
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return err
+	}
+	if _, err := os.Stat(filepath.Join(fuzzDir, "Cargo.toml")); os.IsNotExist(err) {
+		if err := writeTemplate(filepath.Join(fuzzDir, "Cargo.toml"), fuzzManifest, h); err != nil {
+			return err
+		}
+		ignore := []byte("target\ncorpus\nartifacts\ncoverage\n")
+		if err := ioutil.WriteFile(filepath.Join(fuzzDir, ".gitignore"), ignore, 0644); err != nil {
+			return err
+		}
+	}
+	if err := writeTemplate(dest, fuzzTemplate, h); err != nil {
+		return err
+	}
+	return addTarget(fuzzDir, "bin", name, `path = "fuzz_targets/`+name+`.rs"`, "test = false", "doc = false", "bench = false")
+}
+
+// writeTemplate executes the template text with data into the file fname
+func writeTemplate(fname, text string, data interface{}) error {
+	t := template.Must(template.New(filepath.Base(fname)).Parse(text))
+	destination, err := os.Create(fname)
+	if err != nil {
+		return fmt.Errorf("Unable to create file: %v", err)
+	}
+	defer destination.Close()
+	if err := t.Execute(destination, data); err != nil {
+		return fmt.Errorf("Template error: %v", err)
+	}
+	return nil
+}
+
+// newHarness decides how the fuzzer input becomes the arguments of q. A
+// single &[u8] or &str parameter gets the input directly, anything else is
+// decoded with arbitrary.
+func newHarness(q qualified) harness {
+	h := harness{Import: q.Fn.Name, Unsafe: q.Fn.Unsafe}
+	if q.Type != "" {
+		h.Import = q.Type
+	}
+	inputs := propInputs(q)
+	if len(inputs) == 1 && receiver(q.Fn.Args) == "" {
+		arg := skipSelf(q.Fn.Args)[0]
+		name, t := stripType(arg), strings.Join(strings.Fields(argType(arg)), " ")
+		switch derefType(t) {
+		case "[u8]":
+			if borrowOf(t) != "&" {
+				break
+			}
+			h.Param = name + ": &[u8]"
+			h.Call = callWith(q, "", name)
+			return h
+		case "str":
+			if borrowOf(t) != "&" {
+				break
+			}
+			h.Param = "data: &[u8]"
+			h.Setup = []string{
+				"let " + name + " = match std::str::from_utf8(data) {",
+				"	Ok(s) => s,",
+				"	Err(_) => return,",
+				"};",
+			}
+			h.Call = callWith(q, "", name)
+			return h
+		}
+	}
+	h.Missing = needsArbitrary(q)
+	var names, types []string
+	for _, in := range inputs {
+		names = append(names, in[0])
+		types = append(types, in[1])
+	}
+	switch len(inputs) {
+	case 0:
+		h.Param = "_data: &[u8]"
+	case 1:
+		// fuzz_target! takes a plain name, so mutable bindings come after
+		if strings.HasPrefix(names[0], "mut ") {
+			h.Param = "input: " + types[0]
+			h.Setup = []string{"let " + names[0] + " = input;"}
+		} else {
+			h.Param = names[0] + ": " + types[0]
+		}
+	default:
+		h.Param = "input: (" + strings.Join(types, ", ") + ")"
+		h.Setup = []string{"let (" + strings.Join(names, ", ") + ") = input;"}
+	}
+	var args []string
+	for _, a := range skipSelf(q.Fn.Args) {
+		if name := stripType(a); name != "" {
+			args = append(args, borrowOf(argType(a))+name)
+		}
+	}
+	h.Call = callWith(q, "obj", strings.Join(args, ", "))
+	return h
+}
+
+// traitUse gives the use declaration which brings trait into the scope of a
+// fuzz target for the module at path. Traits of the prelude, ie. Default, need
+// none.
+func traitUse(src rust.Source, path, trait string) string {
+	if trait == "" {
+		return ""
+	}
+	name := strings.Split(trait, "::")[0] // the trait, or the module it is in
+	for _, t := range src.Traits {
+		if t.Name == name {
+			return "use " + path + "::" + name + ";"
+		}
+	}
+	for _, u := range src.Uses {
+		decl := strings.TrimSuffix(u, ";")
+		if strings.HasSuffix(decl, "::"+name) || strings.HasSuffix(decl, " as "+name) {
+			return externalUse(u, path)
+		}
+	}
+	return ""
+}
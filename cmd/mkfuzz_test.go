@@ -0,0 +1,25 @@
+package cmd
+
+import "testing"
+
+func TestTraitUse(t *testing.T) {
+	src := parseCode(t, `use std::fmt;
+use crate::shape::Area;
+
+pub trait Scale {
+    fn scale(&mut self, by: f64);
+}
+`)
+	cases := []struct{ trait, want string }{
+		{"", ""},
+		{"Scale", "use my_crate::geo::Scale;"},
+		{"Area", "use my_crate::shape::Area;"},
+		{"fmt::Display", "use std::fmt;"},
+		{"Default", ""},
+	}
+	for _, c := range cases {
+		if got := traitUse(src, "my_crate::geo", c.trait); got != c.want {
+			t.Errorf("traitUse(%q) = %q, want %q", c.trait, got, c.want)
+		}
+	}
+}
@@ -18,10 +18,14 @@ along with this program. If not, see <http://www.gnu.org/licenses/>.
 package cmd
 
 import (
+	"bytes"
 	"fmt"
-	"html/template"
+	"io/ioutil"
 	"os"
+	"path/filepath"
+	"regexp"
 	"strings"
+	"text/template"
 
 	"github.com/skreimeyer/rustbuddy/rust"
 	"github.com/spf13/cobra"
@@ -40,109 +44,242 @@ var mktestCmd = &cobra.Command{
 		assert(
 			my_function(test_arguments) == what-I-want,
 			show-this-note-about-the-testcase-on-error
-			)`,
+			)
+
+	Functions returning a Result or an Option are checked with an Expect enum
+	instead, so that error types need not implement PartialEq. Errors are
+	matched with a predicate, ie. Expect::Err(|e| matches!(e, MyError::NotFound)).
+
+	Methods taking &mut self bind the case object mutably, and an optional
+	"after" field of the case checks the object once the call returns. Methods
+	taking self consume the case object.
+
+	Methods of trait implementations are grouped by impl block and called
+	through the trait, ie. <Type as Trait>::method, to avoid ambiguity. Default
+	methods of a trait are tested when an implementing type is named with
+	--default-impl Trait=Type.
+
+	Async functions get async tests under the runtime named by --runtime:
+	tokio (#[tokio::test]), async-std (#[async_std::test]) or block_on, which
+	adds a minimal executor to the tests module so no dependency is needed.
+
+	With --append, new tests go inside the tests module when the file already
+	has one, adding only the use declarations it lacks. With --integration,
+	tests of public functions are written to tests/<module>.rs of the crate and
+	import the module by its crate path, ie. use mycrate::net::*, along with
+	the use declarations of the source file.
+
+	With --proptest or --quickcheck, each function gets a property test
+	instead, with inputs generated from the parameter types. Types of the crate
+	need #[derive(Arbitrary)] for proptest, or an implementation of
+	quickcheck::Arbitrary, which the generated code points out.
+
+	With --rstest, tests are written for rstest instead. The parameters of the
+	function become #[case] parameters, followed by the expected result, and
+	each labelled case is an attribute, ie. #[case::empty("", 0)].
+
+	Functions which already have a test named like the generated one, ie.
+	test_<fn> or test_<Type>_<method>, are skipped. With --report, mktest lists
+	the functions without a test in each file, or in a whole crate when given
+	a directory, instead of generating anything.`,
 	Run: func(cmd *cobra.Command, args []string) {
+		if !runtimes[runtime] {
+			fmt.Println("Unknown runtime", runtime, "- use tokio, async-std or block_on")
+			return
+		}
 		makeTest(args)
 	},
 }
 
 var out string
 var app bool
+var defaultImpls map[string]string
+var runtime string
+var report bool
+var integration bool
+var proptest bool
+var quickcheck bool
+var rstest bool
+
+// runtimes are the values of --runtime
+var runtimes = map[string]bool{
+	"tokio":     true,
+	"async-std": true,
+	"block_on":  true,
+}
 
 func init() {
 	rootCmd.AddCommand(mktestCmd)
 	mktestCmd.Flags().BoolVar(&app, "append", false, "Append the output to the source file")
 	mktestCmd.Flags().StringVar(&out, "output", "", "Name of file to write output. Defaults to stdout")
+	mktestCmd.Flags().BoolVar(&integration, "integration", false, "Write tests of public functions to an integration test file in tests/")
+	mktestCmd.Flags().BoolVar(&proptest, "proptest", false, "Generate property tests with proptest instead of test cases")
+	mktestCmd.Flags().BoolVar(&quickcheck, "quickcheck", false, "Generate property tests with quickcheck instead of test cases")
+	mktestCmd.Flags().BoolVar(&rstest, "rstest", false, "Generate rstest tests with a #[case] for each input")
+	mktestCmd.Flags().BoolVar(&report, "report", false, "List the functions without a test instead of generating tests")
+	mktestCmd.Flags().StringVar(&runtime, "runtime", "tokio", "runtime for testing async functions: tokio, async-std or block_on")
+	mktestCmd.Flags().StringToStringVar(&defaultImpls, "default-impl", nil, "test the default methods of a trait through an implementing type, ie. Trait=Type")
 }
 
-func makeTest(args []string) {
-	// template setup
-	const mktestTemplate = `
+// mktestTemplate is the default template of mktest. Its "tests" template
+// holds the test functions without the module around them.
+const mktestTemplate = `
 #[cfg(test)]
 mod tests {
-	use super::*;
-
-	// generated code. Edit only test cases!
-	// functions
-	{{range .Funcs | skipMain}}#[test]
-	fn test_{{.Name}}() {
-		{{if len .Args | ne 0 }}#[derive(PartialEq)]
-		struct Input {
-			{{range .Args}}{{.}},
-			{{end}}};{{end}}
-		#[derive(PartialEq)]
-		struct Output {
-			r: {{orUnit .Return}},
-		};
-		#[derive(PartialEq)]
-		struct Case { 
-			input: Input,
-			out: Output,
-			comment: String,
-		};
-		// start test cases
-		for c in vec![
-			// make your test cases here
-			// Case {
-			// 	input: Input {},
-			// 	out: Output{r: },
-			// 	comment: String::from(""),
-			// },
-		]
-		// end of test cases
-		.into_iter() { {{$total := skipSelf .Args | len | lessOne}}
-			assert!(
-				Output{r: {{.Name}}({{range $i,$x := .Args}}c.input.{{stripType $x}}{{if ne $i $total}}, {{end}}{{end}}) }== c.out, c.comment
-		)
-		}
-	}
-	{{end}}
+	use super::*;{{if eq property "proptest"}}
+	use proptest::prelude::*;{{end}}{{if rstest}}
+	use rstest::rstest;{{end}}
+
+	{{template "tests" .}}}//End generated code
+{{define "tests"}}// generated code. Edit only test cases!
+	{{if needsExecutor .}}{{template "blockOn"}}{{end}}// functions
+	{{range .Funcs | skipMain}}{{template "fnTest" (qualify "" "" .)}}{{end}}
 	{{if len .RsStructs | ne 0}}// methods{{end}}
-	{{range .RsStructs}}{{$parent := .Name}}{{range .Methods}}#[test]
-	fn test_{{$parent}}_{{.Name}}() {
-		{{if skipSelf .Args | len | ne 0 }}#[derive(PartialEq)]struct Input {
-			{{range skipSelf .Args}}{{.}},
-			{{end}}};{{end}}
-		#[derive(PartialEq)]
-		struct Output {
-			r: {{orUnit .Return}}
-		};
-		#[derive(PartialEq)]
-		struct Case { 
-			obj:		{{$parent}},{{if skipSelf .Args | len | ne 0 }}
-			input:		Input,{{end}}
-			out:		Output,
+	{{range .RsStructs}}{{$parent := .Name}}{{range .Methods}}{{template "fnTest" (qualify $parent "" .)}}{{end}}{{range .Traits}}{{$trait := .Name}}{{range .Methods}}{{template "fnTest" (qualify $parent $trait .)}}{{end}}{{end}}{{end}}
+	{{range .Traits}}{{$trait := .Name}}{{$impl := implFor .Name}}{{if $impl}}// default methods of {{$trait}}
+	{{range .Defaults}}{{template "fnTest" (qualify $impl $trait .)}}{{end}}{{end}}{{end}}{{end}}
+{{define "fnTest"}}{{if isTested .}}{{else if eq property "proptest"}}{{template "proptest" .}}{{else if eq property "quickcheck"}}{{template "quickcheck" .}}{{else if rstest}}{{template "rstest" .}}{{else}}{{$recv := receiver .Fn.Args}}{{$in := skipSelf .Fn.Args}}{{$mode := outMode .}}{{$after := and (eq $recv "mut") (comparable .Type)}}{{testAttr .Fn}}
+	{{if asyncTest .Fn}}async {{end}}fn {{testName .}}() {
+		{{if len $in | ne 0}}struct Input {
+			{{range $in}}{{ownedArg .}},
+			{{end}}}
+		{{end}}{{if eq $mode "eq"}}#[derive(PartialEq)]
+		struct Output{{outLifetime .}} {
+			r: {{outField .}},
+		}
+		{{end}}{{$x := expectation .}}{{if eq $mode "result"}}enum Expect {
+			Ok({{$x.Want}}),
+			Err{{if $x.Err}}(fn(&{{elidedLifetimes $x.Err}}) -> bool){{end}},
+		}
+		{{else if eq $mode "option"}}enum Expect {
+			Some({{$x.Want}}),
+			None,
+		}
+		{{end}}struct Case { {{if $recv}}
+			obj:		{{objType .Type .Fn.Args}},{{end}}{{if len $in | ne 0}}
+			input:		Input,{{end}}{{if eq $mode "eq"}}
+			out:		Output{{if outLifetime .}}<'static>{{end}},{{else if eq $mode "check"}}
+			check:		fn(&{{outType . | elidedLifetimes}}) -> bool,{{else if eq $mode "result" "option"}}
+			expect:		Expect,{{end}}{{if $after}}
+			after:		Option<{{.Type}}>,{{end}}
 			comment:	String,
-		};
+		}
 		// __TEST CASES GO HERE__
-		let cases = vec![
+		let cases: Vec<Case> = vec![
 			// FIXME
-			// Case {
-			//	obj: 	{{$parent}}{},{{if skipSelf .Args | len | ne 0 }}
-			//	input:	Input{},{{end}}
-			// 	out: 	Output{r: },
+			// Case { {{if $recv}}
+			//	obj: 	{{objType .Type .Fn.Args}}{},{{end}}{{if len $in | ne 0}}
+			//	input:	Input{},{{end}}{{if eq $mode "eq"}}
+			// 	out: 	Output{r: },{{else if eq $mode "check"}}
+			//	check:	|_r| true,{{else if eq $mode "result"}}
+			//	expect:	Expect::Ok(), // or Expect::Err{{if $x.Err}}(|e| matches!(e, ...)){{end}}{{else if eq $mode "option"}}
+			//	expect:	Expect::Some(), // or Expect::None{{end}}{{if $after}}
+			//	after:	None, // or Some({{.Type}}{}) to check the object after the call{{end}}
 			// 	comment:String::from(""),
 			// },
-		]
+		];
 		// __END TEST CASES__
-		.into_iter() { {{$total := skipSelf .Args | len | lessOne}}
-				assert!(
-					Output{r: c.obj.{{.Name}}({{range $i, $x := skipSelf .Args}}c.input.{{stripType $x}}{{if ne $i $total}}, {{end}}{{end}}) == c.out, c.comment
-				)
+		for {{if mutInput .Fn.Args}}mut {{end}}c in cases.into_iter() { {{if eq $recv "mut"}}
+			let mut obj = c.obj;{{end}}{{if .Fn.Unsafe}}
+			// SAFETY: FIXME explain how the safety requirements are met{{end}}
+			{{if eq $mode "eq"}}assert!(
+				Output{r: {{result .}}} == c.out, "{}", c.comment
+			);{{else if eq $mode "check"}}assert!((c.check)(&{{result .}}), "{}", c.comment);{{else if eq $mode "result"}}match ({{result .}}, c.expect) {
+				(Ok(_r), Expect::Ok(want)) => assert!({{$x.Check}}, "{}", c.comment),
+				(Err({{if $x.Err}}_e{{else}}_{{end}}), Expect::Err{{if $x.Err}}(is_err){{end}}) => {{if $x.Err}}assert!(is_err(&_e), "{}: unexpected error", c.comment){{else}}(){{end}},
+				(Ok(_), _) => panic!("{}: expected an error", c.comment),
+				(Err(_), _) => panic!("{}: unexpected error", c.comment),
+			}{{else if eq $mode "option"}}match ({{result .}}, c.expect) {
+				(Some(_r), Expect::Some(want)) => assert!({{$x.Check}}, "{}", c.comment),
+				(None, Expect::None) => (),
+				(Some(_), _) => panic!("{}: expected None", c.comment),
+				(None, _) => panic!("{}: expected Some", c.comment),
+			}{{else}}let _r = {{result .}}; // FIXME: check the result of {{.Fn.Name}}
+			let _ = c.comment;{{end}}{{if $after}}
+			if let Some(after) = c.after {
+				assert!(obj == after, "{}: object after call", c.comment);
+			}{{end}}
+		}
+	}
+	{{end}}{{end}}{{define "rstest"}}{{$mode := outMode .}}{{$x := expectation .}}{{$after := and (eq (receiver .Fn.Args) "mut") (comparable .Type)}}#[rstest]{{if ne (testAttr .Fn) "#[test]"}}
+	{{testAttr .Fn}}{{end}}{{with rsCaseHint .}}
+	// FIXME: add a labelled case for each input, ie.
+	// #[case::label({{.}})]{{end}}
+	{{if asyncTest .Fn}}async {{end}}fn {{testName .}}({{rsParams .}}) {
+		{{if .Fn.Unsafe}}// SAFETY: FIXME explain how the safety requirements are met
+		{{end}}{{if eq $mode "eq"}}{{if eq (outType .) "()"}}{{rsCall .}};{{else if debuggable (outType .)}}assert_eq!({{rsCall .}}, expected);{{else}}assert!({{rsCall .}} == expected);{{end}}{{else if eq $mode "check"}}assert!(check(&{{rsCall .}}));{{else if eq $mode "result"}}match ({{rsCall .}}, expected) {
+			(Ok(_r), Ok(want)) => assert!({{$x.Check}}),
+			(Err({{if $x.Err}}_e{{else}}_{{end}}), Err({{if $x.Err}}is_err{{else}}_{{end}})) => {{if $x.Err}}assert!(is_err(&_e), "unexpected error"){{else}}(){{end}},
+			(Ok(_), Err(_)) => panic!("expected an error"),
+			(Err(_), Ok(_)) => panic!("unexpected error"),
+		}{{else if eq $mode "option"}}match ({{rsCall .}}, expected) {
+			(Some(_r), Some(want)) => assert!({{$x.Check}}),
+			(None, None) => (),
+			(Some(_), None) => panic!("expected None"),
+			(None, Some(_)) => panic!("expected Some"),
+		}{{else}}let _r = {{rsCall .}}; // FIXME: check the result of {{.Fn.Name}}{{end}}{{if $after}}
+		if let Some(after) = after {
+			assert!(obj == after, "object after call");
+		}{{end}}
+	}
+	{{end}}{{define "proptest"}}proptest! {
+		{{range needsArbitrary .}}// FIXME: {{.}} needs #[derive(Arbitrary)] or a strategy of its own
+		{{end}}#[test]
+		fn {{testName .}}({{propParams .}}) {
+			{{if .Fn.Unsafe}}// SAFETY: FIXME explain how the safety requirements are met
+			{{end}}let _r = {{propCall .}};
+			// FIXME: state a property of {{.Fn.Name}}, ie. prop_assert_eq!(..)
+			prop_assert!(true);
+		}
+	}
+	{{end}}{{define "quickcheck"}}#[test]
+	fn {{testName .}}() {
+		{{range needsArbitrary .}}// FIXME: {{.}} needs an implementation of quickcheck::Arbitrary
+		{{end}}fn prop({{qcParams .}}) -> bool {
+			{{if .Fn.Unsafe}}// SAFETY: FIXME explain how the safety requirements are met
+			{{end}}let _r = {{propCall .}};
+			true // FIXME: state a property of {{.Fn.Name}}
+		}
+		quickcheck::quickcheck(prop as fn({{qcTypes .}}) -> bool);
+	}
+	{{end}}{{define "blockOn"}}// A minimal executor for async functions, so no runtime is needed.
+	fn block_on<F: std::future::Future>(fut: F) -> F::Output {
+		use std::task::{Context, Poll, RawWaker, RawWakerVTable, Waker};
+		fn raw_waker() -> RawWaker {
+			fn clone(_: *const ()) -> RawWaker {
+				raw_waker()
 			}
+			fn noop(_: *const ()) {}
+			static VTABLE: RawWakerVTable = RawWakerVTable::new(clone, noop, noop, noop);
+			RawWaker::new(std::ptr::null(), &VTABLE)
 		}
+		// SAFETY: the waker does nothing and never dereferences its data.
+		let waker = unsafe { Waker::from_raw(raw_waker()) };
+		let mut cx = Context::from_waker(&waker);
+		let mut fut = Box::pin(fut);
+		loop {
+			if let Poll::Ready(out) = fut.as_mut().poll(&mut cx) {
+				return out;
+			}
+			std::thread::yield_now();
+		}
+	}
+
+	{{end}}`
 
+func makeTest(args []string) {
+	if report {
+		reportGaps(args)
+		return
+	}
+	if len(args) == 0 {
+		return
 	}
-	{{end}}{{end}}}//End generated code
-`
-	fmap := template.FuncMap{
-		"stripType": stripType,
-		"skipSelf":  skipSelf,
-		"skipMain":  skipMain,
-		"lessOne":   lessOne,
-		"orUnit":    orUnit,
+	testTemp, err := loadTemplate("mktest", args[0])
+	if err != nil {
+		fmt.Println("Template error:", err)
+		return
 	}
-	testTemp := template.Must(template.New("testTemp").Funcs(fmap).Parse(mktestTemplate))
 
 	files := args
 	for _, fname := range files {
@@ -156,6 +293,30 @@ mod tests {
 			fmt.Println("Parsing error:", err)
 			continue
 		}
+		partialEq = derivesOf(source, "PartialEq")
+		arbitrary = derivesOf(source, "Arbitrary")
+		debugTypes = derivesOf(source, "Debug")
+		tested = testNames(source)
+		if integration {
+			f.Close()
+			err = writeIntegration(testTemp, fname, source)
+			if err != nil {
+				fmt.Println("Cannot write integration tests:", err)
+			}
+			continue
+		}
+		if len(gaps(source)) == 0 {
+			fmt.Println("Every function in", fname, "has a test")
+			continue
+		}
+		if app == true && source.TestMod.Name != "" {
+			f.Close()
+			err = insertTests(testTemp, fname, source)
+			if err != nil {
+				fmt.Println("Cannot insert tests:", err)
+			}
+			continue
+		}
 		// This needs a redesign
 		destination := os.Stdout
 		if out != "" {
@@ -182,15 +343,58 @@ mod tests {
 	}
 }
 
-// skipSelf is a helper function to omit the &self argument in methods.
+// skipSelf is a helper function to omit the receiver argument in methods.
 func skipSelf(args []string) []string {
-	if len(args) > 0 && args[0] == "&self" {
+	if receiver(args) != "" {
 		return args[1:]
 	}
 	return args
 }
 
+// receiver classifies the self argument of a method. It returns "ref" for
+// &self, "mut" for &mut self, "value" for self, "typed" for receivers such as
+// self: Rc<Self> and an empty string for associated functions.
+func receiver(args []string) string {
+	if len(args) == 0 {
+		return ""
+	}
+	a := strings.Join(strings.Fields(args[0]), " ")
+	a = strings.TrimPrefix(a, "mut ")
+	switch {
+	case a == "self":
+		return "value"
+	case strings.HasPrefix(a, "self:"):
+		t := strings.TrimSpace(a[len("self:"):])
+		switch {
+		case t == "Self":
+			return "value"
+		case strings.HasPrefix(t, "&") && strings.Contains(t, "mut "):
+			return "mut"
+		case strings.HasPrefix(t, "&"):
+			return "ref"
+		}
+		return "typed"
+	case strings.HasPrefix(a, "&") && strings.HasSuffix(a, "self"):
+		if strings.Contains(a, "mut ") {
+			return "mut"
+		}
+		return "ref"
+	}
+	return ""
+}
+
+// objType gives the type of the object a method is called on. This is the
+// parent type, unless the receiver names another, ie. self: Rc<Self>.
+func objType(parent string, args []string) string {
+	if receiver(args) != "typed" {
+		return parent
+	}
+	t := strings.SplitN(args[0], ":", 2)[1]
+	return replaceSelf(parent, strings.TrimSpace(t))
+}
+
 // stripType is a helper function that takes a function argument (ie,
+//
 //	name: type) and returns a string with only the argument name.
 func stripType(s string) string {
 	if strings.HasPrefix(s, "&self") || len(s) == 0 {
@@ -200,7 +404,23 @@ func stripType(s string) string {
 	if i == -1 {
 		return strings.TrimSpace(s)
 	}
-	return strings.TrimSpace(s[:i])
+	return strings.TrimSpace(strings.TrimPrefix(s[:i], "mut "))
+}
+
+// ownedArg gives the field of an Input struct for a function argument, with
+// borrowed types replaced by types which own their data.
+func ownedArg(arg string) string {
+	return stripType(arg) + ": " + ownedType(argType(arg))
+}
+
+// mutInput reports whether any argument is borrowed mutably from the case
+func mutInput(args []string) bool {
+	for _, a := range skipSelf(args) {
+		if borrowOf(argType(a)) == "&mut " {
+			return true
+		}
+	}
+	return false
 }
 
 // skipMain ignores the "main" function
@@ -223,3 +443,434 @@ func orUnit(s string) string {
 	}
 	return s
 }
+
+// callArgs gives the arguments for a call from the fields of the Input struct
+// of a test case, omitting any self argument. Arguments with borrowed types
+// are borrowed from the case.
+func callArgs(args []string) string {
+	var names []string
+	for _, a := range skipSelf(args) {
+		if n := stripType(a); n != "" {
+			names = append(names, borrowOf(argType(a))+"c.input."+n)
+		}
+	}
+	return strings.Join(names, ", ")
+}
+
+// outMode decides how the result of a call is checked. Comparable results are
+// compared with an expected value ("eq"), others are passed to a predicate
+// ("check"). Results of an anonymous type cannot be named in a test case, so
+// they are not checked at all ("none").
+func outMode(q qualified) string {
+	r := strings.TrimSpace(q.Fn.Return)
+	switch {
+	case strings.HasPrefix(r, "impl "):
+		return "none"
+	case rust.BaseName(r) == "Result":
+		return "result"
+	case rust.BaseName(r) == "Option":
+		return "option"
+	case comparable(replaceSelf(q.Type, r)):
+		return "eq"
+	}
+	return "check"
+}
+
+// outType gives the type of the result kept by a test case. Borrowed results
+// of comparable types are converted to owned values and named lifetimes
+// become 'static.
+func outType(q qualified) string {
+	r := replaceSelf(q.Type, orUnit(strings.TrimSpace(q.Fn.Return)))
+	if outMode(q) == "eq" && borrowOf(r) != "" {
+		return ownedType(r)
+	}
+	return staticLifetimes(r)
+}
+
+// outLifetime gives the lifetime parameter of the Output of a test case, for
+// results which borrow from the input of the case.
+func outLifetime(q qualified) string {
+	if strings.Contains(outType(q), "'") {
+		return "<'a>"
+	}
+	return ""
+}
+
+// outField gives the type of the result in the Output of a test case, which
+// borrows for the lifetime of the Output.
+func outField(q qualified) string {
+	return lifetimePattern.ReplaceAllString(outType(q), "'a")
+}
+
+// expect describes the success and failure of a function returning a Result
+// or an Option.
+type expect struct {
+	Want  string // type of the value expected on success
+	Check string // expression comparing the value _r with want
+	Err   string // error type, which is unknown for aliases like io::Result
+}
+
+// expectation splits the Result or Option returned by the function of a test
+// case. Success values which cannot be compared are checked with a predicate.
+func expectation(q qualified) expect {
+	var x expect
+	r := replaceSelf(q.Type, strings.TrimSpace(q.Fn.Return))
+	head, args := rust.SplitGeneric(r)
+	ok := "()"
+	if len(args) > 0 {
+		ok = args[0]
+	}
+	switch {
+	case len(args) > 1:
+		x.Err = staticLifetimes(args[1])
+	case strings.HasSuffix(head, "io::Result"):
+		x.Err = "std::io::Error"
+	case strings.HasSuffix(head, "fmt::Result"):
+		x.Err = "std::fmt::Error"
+	}
+	switch {
+	case !comparable(ok):
+		x.Want = "fn(&" + elidedLifetimes(ok) + ") -> bool"
+		x.Check = "want(&_r)"
+	case borrowOf(ok) != "":
+		x.Want = ownedType(ok)
+		x.Check = "_r.to_owned() == want"
+	default:
+		x.Want = staticLifetimes(ok)
+		x.Check = "_r == want"
+	}
+	return x
+}
+
+// result gives the expression calling the function of a test case
+func result(q qualified) string {
+	return finishCall(q, methodCall(q))
+}
+
+// finishCall completes a call for use as a value, awaiting async functions
+// and taking ownership of borrowed results which are compared.
+func finishCall(q qualified, call string) string {
+	if q.Fn.Unsafe { // the call is completed inside of its unsafe block
+		safe := q
+		safe.Fn.Unsafe = false
+		call = strings.TrimSuffix(strings.TrimPrefix(call, "unsafe { "), " }")
+		return "unsafe { " + finishCall(safe, call) + " }"
+	}
+	if q.Fn.Async && blocking() {
+		call = "block_on(" + call + ")"
+	} else if q.Fn.Async {
+		call += ".await"
+	}
+	r := replaceSelf(q.Type, strings.TrimSpace(q.Fn.Return))
+	if outMode(q) == "eq" && borrowOf(r) != "" {
+		call += ".to_owned()"
+	}
+	return call
+}
+
+// methodCall gives the expression calling a method on the object of a test
+// case. Methods of traits are called by their full path. A &mut self receiver
+// is bound to obj so that it can be checked after the call.
+func methodCall(q qualified) string {
+	if receiver(q.Fn.Args) == "mut" {
+		return callWith(q, "obj", callArgs(q.Fn.Args))
+	}
+	return callWith(q, "c.obj", callArgs(q.Fn.Args))
+}
+
+// callWith gives the expression calling the function of q with args on the
+// object obj. Unsafe functions are called in an unsafe block.
+func callWith(q qualified, obj, args string) string {
+	if q.Fn.Unsafe {
+		safe := q
+		safe.Fn.Unsafe = false
+		return "unsafe { " + callWith(safe, obj, args) + " }"
+	}
+	recv := receiver(q.Fn.Args)
+	if q.Type == "" {
+		return fmt.Sprintf("%s(%s)", q.Fn.Name, args)
+	}
+	if q.Trait == "" {
+		if recv == "" {
+			return fmt.Sprintf("%s::%s(%s)", q.Type, q.Fn.Name, args)
+		}
+		return fmt.Sprintf("%s.%s(%s)", obj, q.Fn.Name, args)
+	}
+	self := map[string]string{
+		"":      "",
+		"ref":   "&" + obj,
+		"mut":   "&mut " + obj,
+		"value": obj,
+		"typed": obj,
+	}[recv]
+	if self != "" && args != "" {
+		self += ", "
+	}
+	return fmt.Sprintf("<%s as %s>::%s(%s%s)", q.Type, q.Trait, q.Fn.Name, self, args)
+}
+
+// qualified is a method of Type, called through Trait (if any), ie.
+// <Type as Trait>::method
+type qualified struct {
+	Type  string
+	Trait string
+	Fn    rust.Fn
+}
+
+func qualify(typ, trait string, f rust.Fn) qualified {
+	return qualified{Type: typ, Trait: trait, Fn: f}
+}
+
+// implFor gives the type used to test the default methods of a trait, if the
+// user named one.
+func implFor(trait string) string {
+	return defaultImpls[trait]
+}
+
+// replaceSelf substitutes the concrete type for Self, which has no meaning
+// outside of an impl block.
+func replaceSelf(parent, s string) string {
+	re := regexp.MustCompile(`\bSelf\b`)
+	return re.ReplaceAllString(s, parent)
+}
+
+// testAttr gives the attribute marking a test function. Async functions are
+// tested under the runtime chosen by the user.
+func testAttr(f rust.Fn) string {
+	if !f.Async {
+		return "#[test]"
+	}
+	switch {
+	case blocking():
+		return "#[test]"
+	case runtime == "async-std":
+		return "#[async_std::test]"
+	}
+	return "#[tokio::test]"
+}
+
+// asyncTest reports whether the test of f must itself be async
+func asyncTest(f rust.Fn) bool {
+	return f.Async && !blocking()
+}
+
+// blocking reports whether async functions are called through the block_on
+// executor. Property tests cannot be async, so they always are.
+func blocking() bool {
+	return runtime == "block_on" || property() != ""
+}
+
+// needsExecutor reports whether the new tests of src need the block_on
+// executor
+func needsExecutor(src rust.Source) bool {
+	if !blocking() {
+		return false
+	}
+	for _, f := range src.TestMod.Funcs {
+		if f.Name == "block_on" {
+			return false
+		}
+	}
+	for _, q := range gaps(src) {
+		if q.Fn.Async {
+			return true
+		}
+	}
+	return false
+}
+
+// insertTests adds the missing tests of src to the tests module already in
+// fname, before its closing brace. use super::* is added if the module does
+// not have it.
+func insertTests(t *template.Template, fname string, src rust.Source) error {
+	content, err := ioutil.ReadFile(fname)
+	if err != nil {
+		return err
+	}
+	var tests bytes.Buffer
+	if err := t.ExecuteTemplate(&tests, "tests", src); err != nil {
+		return err
+	}
+	mod := src.TestMod.Span
+	var b bytes.Buffer
+	b.Write(content[:mod.Start.Offset+1])
+	for _, use := range testUses() {
+		if !hasUse(src.TestMod.Uses, use) {
+			b.WriteString("\n\t" + use)
+		}
+	}
+	b.Write(content[mod.Start.Offset+1 : mod.End.Offset])
+	b.WriteString("\n\t")
+	b.WriteString(strings.TrimRight(tests.String(), " \t\n") + "\n")
+	b.Write(content[mod.End.Offset:])
+	return ioutil.WriteFile(fname, b.Bytes(), 0660)
+}
+
+// writeIntegration writes tests for the public functions of src to the
+// integration test file of its module, tests/<module>.rs, adding to the file
+// if it exists.
+func writeIntegration(t *template.Template, fname string, src rust.Source) error {
+	root, path, err := crateModule(fname)
+	if err != nil {
+		return err
+	}
+	dest := filepath.Join(root, "tests", lastSegment(path)+".rs")
+	use := "use " + path + "::*;"
+
+	var content []byte
+	if existing, err := os.Open(dest); err == nil {
+		prior, err := rust.Parse(existing)
+		existing.Close()
+		if err != nil {
+			return err
+		}
+		for name := range testNames(prior) {
+			tested[name] = true
+		}
+		// helpers of an integration test file are at the top level
+		src.TestMod.Funcs = prior.Funcs
+		content, _ = ioutil.ReadFile(dest)
+	}
+	src = publicOnly(src)
+	if len(gaps(src)) == 0 {
+		fmt.Println("Every public function in", fname, "has a test")
+		return nil
+	}
+	var tests bytes.Buffer
+	if err := t.ExecuteTemplate(&tests, "tests", src); err != nil {
+		return err
+	}
+	var uses []string
+	for _, u := range src.Uses {
+		if u = externalUse(u, path); u != "" {
+			uses = append(uses, u)
+		}
+	}
+	var b bytes.Buffer
+	for _, use := range append(append(uses, testUses()[1:]...), use) {
+		if !strings.Contains(string(content), use) {
+			b.WriteString(use + "\n")
+		}
+	}
+	b.Write(content)
+	b.WriteString("\n")
+	// the tests are not in a module, so take away a level of indentation
+	b.WriteString(strings.Replace(strings.TrimRight(tests.String(), " \t\n"), "\n\t", "\n", -1) + "\n")
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(dest, b.Bytes(), 0660)
+}
+
+// externalUse rewrites a use declaration of the module at path, ie.
+// mycrate::net, for use outside of the crate. Paths starting with crate, self
+// or super are made absolute. An empty string is returned for paths above the
+// crate root.
+func externalUse(use, path string) string {
+	decl := strings.TrimSuffix(strings.TrimPrefix(use, "use "), ";")
+	segments := strings.Split(path, "::")
+	prefix := ""
+	switch {
+	case strings.HasPrefix(decl, "crate::"):
+		prefix, decl = segments[0], strings.TrimPrefix(decl, "crate")
+	case strings.HasPrefix(decl, "self::"):
+		prefix, decl = path, strings.TrimPrefix(decl, "self")
+	case strings.HasPrefix(decl, "super::"):
+		for strings.HasPrefix(decl, "super::") {
+			if len(segments) == 1 {
+				return ""
+			}
+			segments = segments[:len(segments)-1]
+			decl = strings.TrimPrefix(decl, "super::")
+		}
+		prefix, decl = strings.Join(segments, "::"), "::"+decl
+	}
+	return "use " + prefix + decl + ";"
+}
+
+// publicOnly removes the functions and methods of src which cannot be called
+// from outside the crate. Methods of a trait impl are public when both the
+// type and the trait are. Types and traits declared elsewhere are assumed to
+// be public.
+func publicOnly(src rust.Source) rust.Source {
+	private := privateItems(src)
+	var funcs []rust.Fn
+	for _, f := range src.Funcs {
+		if f.Public {
+			funcs = append(funcs, f)
+		}
+	}
+	src.Funcs = funcs
+	structs := make([]rust.RsStruct, len(src.RsStructs))
+	for i, st := range src.RsStructs {
+		var methods []rust.Fn
+		var traits []rust.Trait
+		if !private[st.Name] {
+			for _, m := range st.Methods {
+				if m.Public {
+					methods = append(methods, m)
+				}
+			}
+			for _, t := range st.Traits {
+				if !private[t.Name] {
+					traits = append(traits, t)
+				}
+			}
+		}
+		st.Methods, st.Traits = methods, traits
+		structs[i] = st
+	}
+	src.RsStructs = structs
+	var traits []rust.Trait
+	for _, t := range src.Traits {
+		if !private[t.Name] && !private[implFor(t.Name)] {
+			traits = append(traits, t)
+		}
+	}
+	src.Traits = traits
+	return src
+}
+
+// privateItems gives the names of the structs, enums and traits src declares
+// without pub
+func privateItems(src rust.Source) map[string]bool {
+	private := make(map[string]bool)
+	for _, st := range src.RsStructs {
+		if st.Span != (rust.Span{}) && !st.Public {
+			private[st.Name] = true
+		}
+	}
+	for _, e := range src.Enums {
+		if !e.Public {
+			private[e.Name] = true
+		}
+	}
+	for _, t := range src.Traits {
+		if t.Span != (rust.Span{}) && !t.Public {
+			private[t.Name] = true
+		}
+	}
+	return private
+}
+
+// testUses lists the use declarations the generated tests need
+func testUses() []string {
+	uses := []string{"use super::*;"}
+	if property() == "proptest" {
+		uses = append(uses, "use proptest::prelude::*;")
+	}
+	if rstest {
+		uses = append(uses, "use rstest::rstest;")
+	}
+	return uses
+}
+
+// hasUse reports whether the use declaration is among uses
+func hasUse(uses []string, use string) bool {
+	for _, u := range uses {
+		if u == use {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,156 @@
+package cmd
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestExternalUse(t *testing.T) {
+	cases := []struct{ use, path, want string }{
+		{"use std::rc::Rc;", "my_crate::net", "use std::rc::Rc;"},
+		{"use crate::lexer::Token;", "my_crate::net", "use my_crate::lexer::Token;"},
+		{"use crate::{a, b};", "my_crate::net", "use my_crate::{a, b};"},
+		{"use self::tcp::Stream;", "my_crate::net", "use my_crate::net::tcp::Stream;"},
+		{"use super::Config;", "my_crate::net::tcp", "use my_crate::net::Config;"},
+		{"use super::super::Config;", "my_crate::net::tcp", "use my_crate::Config;"},
+		{"use super::*;", "my_crate", ""},
+	}
+	for _, c := range cases {
+		if got := externalUse(c.use, c.path); got != c.want {
+			t.Errorf("externalUse(%q, %q) = %q, want %q", c.use, c.path, got, c.want)
+		}
+	}
+}
+
+func TestWriteIntegrationUses(t *testing.T) {
+	root := tempCrate(t, "src/lib.rs")
+	defer os.RemoveAll(root)
+	fname := filepath.Join(root, "src", "parser.rs")
+	code := `use std::num::ParseIntError;
+use std::rc::Rc;
+use crate::lexer::Token;
+
+pub fn parse(s: &str) -> Result<Rc<u32>, ParseIntError> {
+    s.parse().map(Rc::new)
+}
+`
+	if err := ioutil.WriteFile(fname, []byte(code), 0644); err != nil {
+		t.Fatal(err)
+	}
+	src := parseCode(t, code)
+	tmpl, err := loadTemplate("mktest", fname)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tested = testNames(src)
+	defer func() { tested = nil }()
+	if err := writeIntegration(tmpl, fname, src); err != nil {
+		t.Fatal(err)
+	}
+	out, err := ioutil.ReadFile(filepath.Join(root, "tests", "parser.rs"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "use std::num::ParseIntError;\nuse std::rc::Rc;\nuse my_crate::lexer::Token;\nuse my_crate::parser::*;\n"
+	if !strings.HasPrefix(string(out), want) {
+		t.Errorf("Expected the file to start with\n%s\nFound:\n%s", want, out)
+	}
+}
+
+func TestPublicOnly(t *testing.T) {
+	src := parseCode(t, `pub trait Area {
+    fn area(&self) -> f64;
+}
+
+trait Secret {
+    fn secret(&self) -> u8;
+}
+
+impl Area for Hidden {
+    fn area(&self) -> f64 { 0.0 }
+}
+
+struct Hidden;
+
+pub struct Shown;
+
+impl Shown {
+    pub fn new() -> Self { Shown }
+    fn helper(&self) {}
+}
+
+impl Area for Shown {
+    fn area(&self) -> f64 { 1.0 }
+}
+
+impl Secret for Shown {
+    fn secret(&self) -> u8 { 0 }
+}
+
+pub(crate) enum Kind { A }
+
+impl Area for Kind {
+    fn area(&self) -> f64 { 2.0 }
+}
+
+pub fn open() {}
+fn closed() {}
+`)
+	var names []string
+	for _, q := range testable(publicOnly(src)) {
+		names = append(names, testName(q))
+	}
+	want := "test_open test_Shown_new test_Shown_Area_area"
+	if strings.Join(names, " ") != want {
+		t.Errorf("Expected %s. Found %v", want, names)
+	}
+}
+
+func TestCallUnsafe(t *testing.T) {
+	src := parseCode(t, `pub unsafe fn read(p: *const u8) -> u8 { *p }
+
+pub async unsafe fn fetch(p: *const u8) -> String { String::new() }
+
+pub struct Buffer;
+
+impl Buffer {
+    pub unsafe fn get(&self, i: usize) -> u8 { 0 }
+}
+`)
+	cases := []struct {
+		q    qualified
+		want string
+	}{
+		{qualified{Fn: src.Funcs[0]}, "unsafe { read(c.input.p) }"},
+		{qualified{Fn: src.Funcs[1]}, "unsafe { fetch(c.input.p).await }"},
+		{qualified{Type: "Buffer", Fn: src.RsStructs[0].Methods[0]}, "unsafe { c.obj.get(c.input.i) }"},
+	}
+	for _, c := range cases {
+		if got := result(c.q); got != c.want {
+			t.Errorf("result(%s) = %q, want %q", c.q.Fn.Name, got, c.want)
+		}
+	}
+}
+
+func TestOutLifetimes(t *testing.T) {
+	src := parseCode(t, `pub fn words<'a>(s: &'a str) -> Vec<&'a str> { vec![s] }
+pub fn first<'a>(s: &'a str) -> Result<Vec<&'a str>, &'a str> { Ok(vec![s]) }
+`)
+	words, first := qualified{Fn: src.Funcs[0]}, qualified{Fn: src.Funcs[1]}
+	if got := outLifetime(words) + " " + outField(words); got != "<'a> Vec<&'a str>" {
+		t.Errorf("Invalid Output of words: %s", got)
+	}
+	if got := outType(words); got != "Vec<&'static str>" {
+		t.Errorf("outType(words) = %s, want Vec<&'static str>", got)
+	}
+	x := expectation(first)
+	if x.Want != "Vec<&'static str>" || x.Err != "&'static str" {
+		t.Errorf("Invalid expectation of first: %+v", x)
+	}
+	if got := elidedLifetimes("&'a Token<'b>"); got != "&Token<'_>" {
+		t.Errorf("elidedLifetimes(&'a Token<'b>) = %s, want &Token<'_>", got)
+	}
+}
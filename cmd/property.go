@@ -0,0 +1,168 @@
+package cmd
+
+import (
+	"strings"
+
+	"github.com/skreimeyer/rustbuddy/rust"
+)
+
+// Helpers for generating property tests with proptest or quickcheck. Inputs
+// are generated from the owned types of the parameters, so &str is tested
+// with arbitrary Strings.
+
+// arbitrary holds the names of types in the current source file which derive
+// Arbitrary. It must be set before generating property tests.
+var arbitrary map[string]bool
+
+// property names the crate used for property tests, if any
+func property() string {
+	switch {
+	case proptest:
+		return "proptest"
+	case quickcheck:
+		return "quickcheck"
+	}
+	return ""
+}
+
+// strategy gives a proptest strategy generating values of type t
+func strategy(t string) string {
+	t = strings.TrimSpace(t)
+	if strings.HasPrefix(t, "(") && strings.HasSuffix(t, ")") {
+		var elems []string
+		for _, e := range rust.SplitTop(t[1:len(t)-1], ',') {
+			if e = strings.TrimSpace(e); e != "" {
+				elems = append(elems, strategy(e))
+			}
+		}
+		if len(elems) == 0 {
+			return "Just(())"
+		}
+		if len(elems) == 1 {
+			return "(" + elems[0] + ",)"
+		}
+		return "(" + strings.Join(elems, ", ") + ")"
+	}
+	head, args := rust.SplitGeneric(t)
+	// containers are only generated from their own arguments when all of
+	// them are written out, ie. not for an alias such as io::Result<u8>
+	switch base := rust.BaseName(head); {
+	case base == "String":
+		return `".*"`
+	case base == "Vec" && len(args) == 1:
+		return "proptest::collection::vec(" + strategy(args[0]) + ", 0..10)"
+	case base == "VecDeque" && len(args) == 1:
+		return "proptest::collection::vec_deque(" + strategy(args[0]) + ", 0..10)"
+	case base == "HashSet" && len(args) == 1:
+		return "proptest::collection::hash_set(" + strategy(args[0]) + ", 0..10)"
+	case base == "BTreeSet" && len(args) == 1:
+		return "proptest::collection::btree_set(" + strategy(args[0]) + ", 0..10)"
+	case base == "HashMap" && len(args) == 2:
+		return "proptest::collection::hash_map(" + strategy(args[0]) + ", " + strategy(args[1]) + ", 0..10)"
+	case base == "BTreeMap" && len(args) == 2:
+		return "proptest::collection::btree_map(" + strategy(args[0]) + ", " + strategy(args[1]) + ", 0..10)"
+	case base == "Option" && len(args) == 1:
+		return "proptest::option::of(" + strategy(args[0]) + ")"
+	case base == "Result" && len(args) == 2:
+		return "proptest::result::maybe_ok(" + strategy(args[0]) + ", " + strategy(args[1]) + ")"
+	case base == "Box" && len(args) == 1:
+		return strategy(args[0]) + ".prop_map(Box::new)"
+	}
+	return "any::<" + t + ">()"
+}
+
+// propInputs lists the name and owned type of each value a property test
+// generates: the object of a method, as obj, followed by the parameters.
+// Values which are borrowed mutably, or bound mutably as the receiver, are
+// prefixed with mut.
+func propInputs(q qualified) [][2]string {
+	var inputs [][2]string
+	switch receiver(q.Fn.Args) {
+	case "":
+	case "mut":
+		inputs = append(inputs, [2]string{"mut obj", objType(q.Type, q.Fn.Args)})
+	default:
+		inputs = append(inputs, [2]string{"obj", objType(q.Type, q.Fn.Args)})
+	}
+	for _, a := range skipSelf(q.Fn.Args) {
+		name := stripType(a)
+		if name == "" {
+			continue
+		}
+		if borrowOf(argType(a)) == "&mut " {
+			name = "mut " + name
+		}
+		inputs = append(inputs, [2]string{name, ownedType(replaceSelf(q.Type, argType(a)))})
+	}
+	return inputs
+}
+
+// propParams gives the parameters of a proptest function, ie. a in any::<i32>()
+func propParams(q qualified) string {
+	var params []string
+	for _, in := range propInputs(q) {
+		params = append(params, in[0]+" in "+strategy(in[1]))
+	}
+	return strings.Join(params, ", ")
+}
+
+// qcParams gives the parameters of a quickcheck property, ie. a: i32
+func qcParams(q qualified) string {
+	var params []string
+	for _, in := range propInputs(q) {
+		params = append(params, in[0]+": "+in[1])
+	}
+	return strings.Join(params, ", ")
+}
+
+// qcTypes gives the parameter types of a quickcheck property
+func qcTypes(q qualified) string {
+	var types []string
+	for _, in := range propInputs(q) {
+		types = append(types, in[1])
+	}
+	return strings.Join(types, ", ")
+}
+
+// propCall gives the expression calling the function with the generated
+// values instead of the fields of a test case.
+func propCall(q qualified) string {
+	return strings.NewReplacer("c.input.", "", "c.obj", "obj").Replace(result(q))
+}
+
+// needsArbitrary lists the types among the inputs of a property test for
+// which no values can be generated without help from the user.
+func needsArbitrary(q qualified) []string {
+	var missing []string
+	seen := make(map[string]bool)
+	var walk func(t string)
+	walk = func(t string) {
+		t = strings.TrimSpace(t)
+		if strings.HasPrefix(t, "(") || strings.HasPrefix(t, "[") {
+			inner := strings.Trim(t, "()[]")
+			for _, e := range rust.SplitTop(rust.SplitTop(inner, ';')[0], ',') {
+				walk(e)
+			}
+			return
+		}
+		if t == "" || strings.HasPrefix(t, "'") {
+			return
+		}
+		base := rust.BaseName(t)
+		if containers[base] {
+			_, args := rust.SplitGeneric(t)
+			for _, a := range args {
+				walk(a)
+			}
+			return
+		}
+		if !primitives[base] && !arbitrary[base] && !seen[base] {
+			seen[base] = true
+			missing = append(missing, base)
+		}
+	}
+	for _, in := range propInputs(q) {
+		walk(in[1])
+	}
+	return missing
+}
@@ -0,0 +1,25 @@
+package cmd
+
+import "testing"
+
+func TestStrategy(t *testing.T) {
+	cases := []struct{ t, want string }{
+		{"i32", "any::<i32>()"},
+		{"String", `".*"`},
+		{"Vec<u8>", "proptest::collection::vec(any::<u8>(), 0..10)"},
+		{"Option<String>", `proptest::option::of(".*")`},
+		{"HashMap<String, i32>", `proptest::collection::hash_map(".*", any::<i32>(), 0..10)`},
+		{"Result<u8, String>", `proptest::result::maybe_ok(any::<u8>(), ".*")`},
+		{"(u8, bool)", "(any::<u8>(), any::<bool>())"},
+		// aliases and bare names fall back to Arbitrary
+		{"io::Result<u8>", "any::<io::Result<u8>>()"},
+		{"Vec", "any::<Vec>()"},
+		{"HashMap<K>", "any::<HashMap<K>>()"},
+		{"Box", "any::<Box>()"},
+	}
+	for _, c := range cases {
+		if got := strategy(c.t); got != c.want {
+			t.Errorf("strategy(%q) = %s, want %s", c.t, got, c.want)
+		}
+	}
+}
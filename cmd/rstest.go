@@ -0,0 +1,79 @@
+package cmd
+
+import "strings"
+
+// Helpers for generating tests with rstest, where each case is an attribute
+// of the test and its values are parameters of the test function.
+
+// rsCase lists the parameters of an rstest test as name and type: the object
+// of a method, the parameters of the function as they are declared and then
+// whatever the result is checked against.
+func rsCase(q qualified) [][2]string {
+	var params [][2]string
+	switch receiver(q.Fn.Args) {
+	case "":
+	case "mut":
+		params = append(params, [2]string{"mut obj", objType(q.Type, q.Fn.Args)})
+	default:
+		params = append(params, [2]string{"obj", objType(q.Type, q.Fn.Args)})
+	}
+	for _, a := range skipSelf(q.Fn.Args) {
+		name := stripType(a)
+		if name == "" || argType(a) == "" {
+			continue
+		}
+		params = append(params, [2]string{name, staticLifetimes(replaceSelf(q.Type, argType(a)))})
+	}
+	x := expectation(q)
+	switch outMode(q) {
+	case "eq":
+		if outType(q) != "()" {
+			params = append(params, [2]string{"expected", outType(q)})
+		}
+	case "check":
+		params = append(params, [2]string{"check", "fn(&" + elidedLifetimes(outType(q)) + ") -> bool"})
+	case "result":
+		fail := "()"
+		if x.Err != "" {
+			fail = "fn(&" + elidedLifetimes(x.Err) + ") -> bool"
+		}
+		params = append(params, [2]string{"expected", "Result<" + x.Want + ", " + fail + ">"})
+	case "option":
+		params = append(params, [2]string{"expected", "Option<" + x.Want + ">"})
+	}
+	if receiver(q.Fn.Args) == "mut" && comparable(q.Type) {
+		params = append(params, [2]string{"after", "Option<" + q.Type + ">"})
+	}
+	return params
+}
+
+// rsParams gives the parameters of an rstest test function
+func rsParams(q qualified) string {
+	var params []string
+	for _, p := range rsCase(q) {
+		params = append(params, "#[case] "+p[0]+": "+p[1])
+	}
+	return strings.Join(params, ", ")
+}
+
+// rsCaseHint names the values of a case in order, as a reminder of what goes
+// in each #[case] attribute
+func rsCaseHint(q qualified) string {
+	var names []string
+	for _, p := range rsCase(q) {
+		names = append(names, strings.TrimPrefix(p[0], "mut "))
+	}
+	return strings.Join(names, ", ")
+}
+
+// rsCall gives the expression calling the function with the parameters of
+// the test, which have the declared types and are passed as they are.
+func rsCall(q qualified) string {
+	var args []string
+	for _, a := range skipSelf(q.Fn.Args) {
+		if name := stripType(a); name != "" {
+			args = append(args, name)
+		}
+	}
+	return finishCall(q, callWith(q, "obj", strings.Join(args, ", ")))
+}
@@ -9,7 +9,6 @@ import (
 	"regexp"
 	"sort"
 	"strings"
-	"text/template"
 
 	"github.com/skreimeyer/rustbuddy/rust"
 	"github.com/spf13/cobra"
@@ -33,12 +32,40 @@ var stringerCmd = &cobra.Command{
 	enum MyEnum{
 		First,
 		Second(i32),
-		Third{a:i32, b:char c:Something::Complicated},
+		Third{a:i32, b:char, c:Something::Complicated},
 	}
 
 	MyEnum::First.to_str() == "First" // &str
-	MyEnum::Second.to_string() == "Second" // String
-	println!("{}",MyEnum::Third) == "Third" // fmt::Result
+	MyEnum::Second(1).to_string() == "Second" // String
+	println!("{}", MyEnum::Third { .. }) == "Third" // fmt::Result
+
+	Generic enums and enums with lifetimes, ie. Token<'a, T: Clone>, get
+	impl blocks declaring the same parameters.
+
+	--case converts the names to snake_case, kebab-case, SCREAMING_SNAKE_CASE,
+	lowercase or Title Case, so with --case kebab-case NotFound becomes
+	"not-found". A variant is renamed with rustbuddy(rename = "...") in an
+	attribute or in a line comment before it:
+
+	enum Status {
+		// rustbuddy(rename = "ok")
+		Success,
+		#[cfg_attr(any(), rustbuddy(rename = "gone"))]
+		NotFound,
+	}
+
+	The cfg_attr keeps the attribute from the compiler, which does not know
+	it.
+
+	--parse adds the inverse for enums of unit variants, FromStr and
+	TryFrom<&str> parsing the same strings, with an error type named after
+	the enum, ie. ParseStatusError. --ignore-case makes parsing ignore the
+	case of the strings.
+
+	--meta adds the helpers often taken from strum: the VARIANT_NAMES table
+	of the strings of the variants, variant_count() and variant_index(), and
+	for enums of unit variants the array ALL of every variant and iter()
+	over them.
 	`,
 	Args: cobra.MinimumNArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
@@ -47,27 +74,36 @@ var stringerCmd = &cobra.Command{
 }
 
 var allEnum bool
+var stringCase string
+var parseEnum bool
+var enumMeta bool
+var ignoreCase bool
+
+// labelCase converts the names of variants to the case given with --case
+var labelCase = func(s string) string { return s }
+
+// renameAttr matches the rename of a variant in its attributes or comments
+var renameAttr = regexp.MustCompile(`rustbuddy\(\s*rename\s*=\s*"((?:[^"\\]|\\.)*)"\s*\)`)
 
 func init() {
 	rootCmd.AddCommand(stringerCmd)
 	stringerCmd.Flags().BoolVar(&allEnum, "all", false, "impl to_string for all enums")
 	stringerCmd.Flags().BoolVar(&writeout, "write", false, "write output into source file")
+	stringerCmd.Flags().BoolVar(&parseEnum, "parse", false, "Also impl FromStr and TryFrom<&str> for enums of unit variants")
+	stringerCmd.Flags().BoolVar(&enumMeta, "meta", false, "Also generate VARIANT_NAMES, variant_count(), variant_index() and, for enums of unit variants, ALL and iter()")
+	stringerCmd.Flags().BoolVar(&ignoreCase, "ignore-case", false, "Parse strings regardless of their case")
+	stringerCmd.Flags().StringVar(&stringCase, "case", "", "Case of the strings: snake_case, kebab-case, SCREAMING_SNAKE_CASE, lowercase or Title Case")
 }
 
-func stringify(args []string) {
-	if len(args) < 2 && allEnum == false {
-		fmt.Println("No enum specified. No changes made. Did you mean to use --all?")
-		return
-	}
-	const stringerTemplate = `
+// stringerTemplate is the default template of stringer, executed for each
+// enum with an enumData.
+const stringerTemplate = `
 //GENERATED CODE DO NOT EDIT
-const {{.Name}}_STR: &str = "{{$c := concat .Variants}}{{$c}}";
-impl {{.Name}} {
-	fn to_str(&self) -> &str {
-		match &self {
-			{{$e := .Name}}{{range $_,$v := .Variants}}{{$e}}::{{delType $v}} => &{{$e}}_STR{{slicer $c $v}},
-			{{end}}
-		}
+impl{{implGenerics .Generics}} {{.Name}}{{typeArgs .Generics}}{{with .Where}} {{.}}{{end}} {
+	fn to_str(&self) -> &'static str {
+		match self {
+{{range .Variants}}			Self::{{variantPattern .}} => "{{variantLabel .}}",
+{{end}}		}
 	}
 
 	fn to_string(&self) -> String {
@@ -75,23 +111,95 @@ impl {{.Name}} {
 	}
 }
 
-use std::fmt;
-impl fmt::Display for {{.Name}} {
-	fn fmt(&self, f: &mut fmt::Formatter<'_>) -> fmt::Result {
+impl{{implGenerics .Generics}} std::fmt::Display for {{.Name}}{{typeArgs .Generics}}{{with .Where}} {{.}}{{end}} {
+	fn fmt(&self, f: &mut std::fmt::Formatter<'_>) -> std::fmt::Result {
 		write!(f, "{}", self.to_str())
 	}
 }
-// END GENERATED CODE`
-	fmap := template.FuncMap{
-		"concat":    concat,
-		"slicer":    slicer,
-		"stripTail": stripTail,
-		"plusOne":   plusOne,
-		"delType":   delType,
+{{if meta}}{{template "meta" .}}{{end}}{{if parse}}{{if unitEnum .Enum}}{{template "fromStr" .}}{{else}}
+// FromStr is not implemented for {{.Name}}, which has variants with fields
+{{end}}{{end}}// END GENERATED CODE{{define "meta"}}
+impl{{implGenerics .Generics}} {{.Name}}{{typeArgs .Generics}}{{with .Where}} {{.}}{{end}} {
+{{if unitEnum .Enum}}	/// Every variant, in the order of declaration
+	pub const ALL: [Self; {{len .Variants}}] = [{{range $i, $v := .Variants}}{{if $i}}, {{end}}Self::{{variantName $v}}{{end}}];
+
+{{end}}	/// The strings of the variants, in the order of declaration
+	pub const VARIANT_NAMES: &'static [&'static str] = &[{{range $i, $v := .Variants}}{{if $i}}, {{end}}"{{variantLabel $v}}"{{end}}];
+{{if unitEnum .Enum}}
+	/// Iterates over every variant, in the order of declaration
+	pub fn iter() -> impl Iterator<Item = Self> {
+		IntoIterator::into_iter(Self::ALL)
+	}
+{{end}}
+	/// The number of variants
+	pub const fn variant_count() -> usize {
+		{{len .Variants}}
+	}
+
+	/// The position of the variant in the declaration
+	pub const fn variant_index(&self) -> usize {
+		match self {
+{{range $i, $v := .Variants}}			Self::{{variantPattern $v}} => {{$i}},
+{{end}}		}
+	}
+}
+{{end}}{{define "fromStr"}}
+/// The error of parsing a string which names no {{.Name}}
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub struct Parse{{.Name}}Error(String);
+
+impl std::fmt::Display for Parse{{.Name}}Error {
+	fn fmt(&self, f: &mut std::fmt::Formatter<'_>) -> std::fmt::Result {
+		write!(f, "unknown {{.Name}} {:?}", self.0)
+	}
+}
+
+impl std::error::Error for Parse{{.Name}}Error {}
+
+impl std::str::FromStr for {{.Name}} {
+	type Err = Parse{{.Name}}Error;
+
+	fn from_str(s: &str) -> std::result::Result<Self, Self::Err> {
+		match {{if ignoreCase}}s.to_lowercase().as_str(){{else}}s{{end}} {
+			{{range .Variants}}"{{parseLabel .}}" => Ok(Self::{{variantName .}}),
+			{{end}}_ => Err(Parse{{.Name}}Error(s.to_string())),
+		}
+	}
+}
+
+impl std::convert::TryFrom<&str> for {{.Name}} {
+	type Error = Parse{{.Name}}Error;
+
+	fn try_from(s: &str) -> std::result::Result<Self, Self::Error> {
+		s.parse()
+	}
+}
+{{end}}`
+
+// enumData is given to the stringer template. The source of the enum is
+// included for templates which need more than the enum itself.
+type enumData struct {
+	rust.Enum
+	Source rust.Source
+}
+
+func stringify(args []string) {
+	if len(args) < 2 && allEnum == false {
+		fmt.Println("No enum specified. No changes made. Did you mean to use --all?")
+		return
+	}
+	var ok bool
+	if labelCase, ok = nameCase(stringCase); !ok {
+		fmt.Println("Unknown case", stringCase, "- use snake_case, kebab-case, SCREAMING_SNAKE_CASE, lowercase or Title Case")
+		return
 	}
 	var buf bytes.Buffer
 	var q enumQueue
-	tmpl := template.Must(template.New("stringerTemplate").Funcs(fmap).Parse(stringerTemplate))
+	tmpl, err := loadTemplate("stringer", args[0])
+	if err != nil {
+		fmt.Println("template error:", err)
+		return
+	}
 	f, err := os.Open(args[0])
 	if err != nil {
 		fmt.Println("Can't open", args[0], err)
@@ -125,7 +233,7 @@ impl fmt::Display for {{.Name}} {
 	for _, e := range q {
 		end := e.Span.End.Offset
 		buf.Write(fBytes[lastByte:end])
-		err = tmpl.Execute(&buf, e)
+		err = tmpl.Execute(&buf, enumData{Enum: e, Source: src})
 		if err != nil {
 			fmt.Println("template error:", err)
 			return
@@ -148,31 +256,35 @@ impl fmt::Display for {{.Name}} {
 	return
 }
 
-func concat(s []string) string {
-	output := ""
-	for _, a := range s {
-		output += stripTail(a)
+// variantLabel gives the string of an enum variant, which is its name in the
+// case given with --case unless the variant is renamed
+func variantLabel(v string) string {
+	for _, a := range rust.VariantAttributes(v) {
+		if m := renameAttr.FindStringSubmatch(a); m != nil {
+			return m[1]
+		}
 	}
-	return output
+	return labelCase(rust.VariantName(v))
 }
 
-func stripTail(s string) string {
-	i := strings.IndexAny(s, ":{(")
-	if i == -1 {
-		return s
+// parseLabel gives the string parsed as an enum variant, which is its label
+// in lower case when parsing ignores case
+func parseLabel(v string) string {
+	if ignoreCase {
+		return strings.ToLower(variantLabel(v))
 	}
-	return s[:i]
+	return variantLabel(v)
 }
 
-func plusOne(i int) int {
-	return i + 1
-}
-
-func slicer(s string, v string) string {
-	v = stripTail(v)
-	i := strings.Index(s, v)
-	j := i + len(v)
-	return fmt.Sprintf("[%d..%d]", i, j)
+// unitEnum reports whether every variant of e is a unit variant, which a
+// string can be parsed into
+func unitEnum(e rust.Enum) bool {
+	for _, v := range e.Variants {
+		if !rust.IsUnitVariant(v) {
+			return false
+		}
+	}
+	return true
 }
 
 type enumQueue []rust.Enum
@@ -182,10 +294,3 @@ func (q enumQueue) Swap(i, j int) { q[i], q[j] = q[j], q[i] }
 func (q enumQueue) Less(i, j int) bool {
 	return q[i].Span.End.Offset < q[j].Span.End.Offset
 }
-
-// pull out anything that looks like a type. I don't expect this to work nicely
-// with deep nesting.
-func delType(s string) string {
-	re := regexp.MustCompile(`:\s*[[:alnum:]]+`)
-	return re.ReplaceAllString(s, "")
-}
@@ -0,0 +1,84 @@
+package cmd
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/skreimeyer/rustbuddy/rust"
+)
+
+// stringerOutput runs the stringer template on the first enum of code
+func stringerOutput(t *testing.T, code string) string {
+	dir, err := ioutil.TempDir("", "stringer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	fname := filepath.Join(dir, "lib.rs")
+	if err := ioutil.WriteFile(fname, []byte(code), 0644); err != nil {
+		t.Fatal(err)
+	}
+	f, _ := os.Open(fname)
+	src, _ := rust.Parse(f)
+	f.Close()
+	if len(src.Enums) == 0 {
+		t.Fatalf("No enum parsed from:\n%s", code)
+	}
+	tmpl, err := loadTemplate("stringer", fname)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var b bytes.Buffer
+	if err := tmpl.Execute(&b, enumData{Enum: src.Enums[0], Source: src}); err != nil {
+		t.Fatal(err)
+	}
+	return b.String()
+}
+
+func TestStringerOverlappingNames(t *testing.T) {
+	out := stringerOutput(t, `enum Status {
+    NotOk,
+    Ok,
+    Okay(u8),
+    O { code: u8 },
+}`)
+	arms := []string{
+		`Self::NotOk => "NotOk",`,
+		`Self::Ok => "Ok",`,
+		`Self::Okay(..) => "Okay",`,
+		`Self::O { .. } => "O",`,
+	}
+	for _, arm := range arms {
+		if !strings.Contains(out, arm) {
+			t.Errorf("Missing arm %s in:\n%s", arm, out)
+		}
+	}
+}
+
+func TestStringerRename(t *testing.T) {
+	labelCase, _ = nameCase("kebab-case")
+	parseEnum, ignoreCase = true, false
+	defer func() {
+		labelCase, parseEnum = func(s string) string { return s }, false
+	}()
+	out := stringerOutput(t, `enum Status {
+    NotOk,
+    // rustbuddy(rename = "ok")
+    Ok,
+}`)
+	lines := []string{
+		`Self::NotOk => "not-ok",`,
+		`Self::Ok => "ok",`,
+		`"not-ok" => Ok(Self::NotOk),`,
+		`"ok" => Ok(Self::Ok),`,
+	}
+	for _, l := range lines {
+		if !strings.Contains(out, l) {
+			t.Errorf("Missing %s in:\n%s", l, out)
+		}
+	}
+}
@@ -0,0 +1,191 @@
+package cmd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"text/template"
+
+	"github.com/skreimeyer/rustbuddy/rust"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// templatesCmd represents the templates command
+var templatesCmd = &cobra.Command{
+	Use:   "templates",
+	Short: "Manage the templates of generated code",
+	Long: `The code generated by mktest, stringer and mkerr comes from Go templates
+	(see https://golang.org/pkg/text/template). Each can be overridden for a
+	project with a file in .rustbuddy/templates named after the command, ie.
+	.rustbuddy/templates/mktest.tmpl, which is looked for in the directory of
+	the source file and its parents. A file named by the config key
+	templates.<command> takes precedence:
+
+	templates:
+	  mktest: /path/to/mktest.tmpl
+
+	An override is parsed on top of the default template, so it may replace
+	the whole template or only some of the templates defined in it, ie.
+	{{define "fnTest"}}...{{end}} in mktest. Templates get the parsed source
+	file, and all of the helper functions of rustbuddy are available to them.`,
+}
+
+// templatesDumpCmd represents the templates dump command
+var templatesDumpCmd = &cobra.Command{
+	Use:   "dump [DIRECTORY]",
+	Short: "Write the default templates for editing",
+	Long: `Dump writes the default templates to DIRECTORY, which defaults to
+	.rustbuddy/templates, as <command>.tmpl. Existing files are kept unless
+	--force is given.`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		dir := filepath.Join(".rustbuddy", "templates")
+		if len(args) == 1 {
+			dir = args[0]
+		}
+		dumpTemplates(dir)
+	},
+}
+
+var force bool
+
+func init() {
+	rootCmd.AddCommand(templatesCmd)
+	templatesCmd.AddCommand(templatesDumpCmd)
+	templatesDumpCmd.Flags().BoolVar(&force, "force", false, "Overwrite existing templates")
+}
+
+// defaultTemplates are the built in templates by command
+var defaultTemplates = map[string]string{
+	"mktest":   mktestTemplate,
+	"stringer": stringerTemplate,
+	"mkerr":    mkerrTemplate,
+}
+
+// templateFuncs are the helper functions available to every template
+func templateFuncs() template.FuncMap {
+	return template.FuncMap{
+		// mktest
+		"stripType":       stripType,
+		"skipSelf":        skipSelf,
+		"skipMain":        skipMain,
+		"lessOne":         lessOne,
+		"orUnit":          orUnit,
+		"callArgs":        callArgs,
+		"receiver":        receiver,
+		"objType":         objType,
+		"methodCall":      methodCall,
+		"qualify":         qualify,
+		"implFor":         implFor,
+		"replaceSelf":     replaceSelf,
+		"ownedArg":        ownedArg,
+		"mutInput":        mutInput,
+		"comparable":      comparable,
+		"outMode":         outMode,
+		"outType":         outType,
+		"outLifetime":     outLifetime,
+		"outField":        outField,
+		"elidedLifetimes": elidedLifetimes,
+		"result":          result,
+		"expectation":     expectation,
+		"testAttr":        testAttr,
+		"asyncTest":       asyncTest,
+		"needsExecutor":   needsExecutor,
+		"testName":        testName,
+		"isTested":        isTested,
+		"property":        property,
+		"propParams":      propParams,
+		"propCall":        propCall,
+		"qcParams":        qcParams,
+		"qcTypes":         qcTypes,
+		"needsArbitrary":  needsArbitrary,
+		"rstest":          func() bool { return rstest },
+		"rsParams":        rsParams,
+		"rsCaseHint":      rsCaseHint,
+		"rsCall":          rsCall,
+		"debuggable":      debuggable,
+		// mkerr
+		"lowerWords": lowerWords,
+		// stringer
+		"variantPattern": rust.VariantPattern,
+		"implGenerics":   rust.GenericParams,
+		"typeArgs":       rust.GenericArgs,
+		"variantLabel":   variantLabel,
+		"variantName":    rust.VariantName,
+		"parseLabel":     parseLabel,
+		"unitEnum":       unitEnum,
+		"parse":          func() bool { return parseEnum },
+		"meta":           func() bool { return enumMeta },
+		"ignoreCase":     func() bool { return ignoreCase },
+	}
+}
+
+// loadTemplate parses the default template of a command along with the
+// user's override, if there is one for the project of the source file near.
+func loadTemplate(name, near string) (*template.Template, error) {
+	t, err := template.New(name).Funcs(templateFuncs()).Parse(defaultTemplates[name])
+	if err != nil {
+		return nil, err
+	}
+	override := templateOverride(name, near)
+	if override == "" {
+		return t, nil
+	}
+	text, err := ioutil.ReadFile(override)
+	if err != nil {
+		return nil, err
+	}
+	return t.Parse(string(text))
+}
+
+// templateOverride finds the file overriding the template of a command. The
+// config key templates.<name> comes first, then .rustbuddy/templates/<name>.tmpl
+// in the directory of near or its parents.
+func templateOverride(name, near string) string {
+	if p := viper.GetString("templates." + name); p != "" {
+		return p
+	}
+	dir, err := filepath.Abs(filepath.Dir(near))
+	if err != nil {
+		return ""
+	}
+	for {
+		p := filepath.Join(dir, ".rustbuddy", "templates", name+".tmpl")
+		if _, err := os.Stat(p); err == nil {
+			return p
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+// dumpTemplates writes the default templates to dir
+func dumpTemplates(dir string) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		fmt.Println("Cannot create", dir, err)
+		return
+	}
+	var names []string
+	for name := range defaultTemplates {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		p := filepath.Join(dir, name+".tmpl")
+		if _, err := os.Stat(p); err == nil && !force {
+			fmt.Println("Keeping existing", p)
+			continue
+		}
+		if err := ioutil.WriteFile(p, []byte(defaultTemplates[name]), 0644); err != nil {
+			fmt.Println("Cannot write", p, err)
+			continue
+		}
+		fmt.Println("Wrote", p)
+	}
+}
@@ -0,0 +1,228 @@
+package cmd
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/skreimeyer/rustbuddy/rust"
+)
+
+// Helpers for generating code from the argument and return types of parsed
+// functions.
+
+// partialEq holds the names of types in the current source file which derive
+// PartialEq. It must be set before calling comparable.
+var partialEq map[string]bool
+
+// debugTypes holds the names of types in the current source file which derive
+// Debug. It must be set before calling debuggable.
+var debugTypes map[string]bool
+
+// derivesOf gives the names of all structs and enums in src deriving trait
+func derivesOf(src rust.Source, trait string) map[string]bool {
+	found := make(map[string]bool)
+	for _, s := range src.RsStructs {
+		for _, d := range s.Derives {
+			if d == trait {
+				found[s.Name] = true
+			}
+		}
+	}
+	for _, e := range src.Enums {
+		for _, d := range e.Derives {
+			if d == trait {
+				found[e.Name] = true
+			}
+		}
+	}
+	return found
+}
+
+var primitives = map[string]bool{
+	"i8": true, "i16": true, "i32": true, "i64": true, "i128": true, "isize": true,
+	"u8": true, "u16": true, "u32": true, "u64": true, "u128": true, "usize": true,
+	"f32": true, "f64": true, "bool": true, "char": true, "str": true, "String": true,
+	"PathBuf": true, "Path": true, "OsString": true, "OsStr": true, "Duration": true,
+}
+
+// containers are comparable when everything they contain is
+var containers = map[string]bool{
+	"Vec": true, "VecDeque": true, "Option": true, "Result": true, "Box": true,
+	"Rc": true, "Arc": true, "Cow": true, "HashMap": true, "BTreeMap": true,
+	"HashSet": true, "BTreeSet": true,
+}
+
+// comparable reports whether values of type t can be compared with ==.
+// Unknown types, including generic parameters, are assumed not to be.
+func comparable(t string) bool {
+	return implements(t, partialEq)
+}
+
+// debuggable reports whether values of type t can be formatted with {:?}
+func debuggable(t string) bool {
+	return implements(t, debugTypes)
+}
+
+// implements reports whether type t has a trait which all primitives and
+// containers have, given the types of the source file deriving it.
+func implements(t string, derived map[string]bool) bool {
+	t = strings.TrimSpace(t)
+	switch {
+	case t == "" || t == "()":
+		return true
+	case strings.HasPrefix(t, "&"):
+		return implements(derefType(t), derived)
+	case strings.HasPrefix(t, "(") && strings.HasSuffix(t, ")"):
+		for _, e := range rust.SplitTop(t[1:len(t)-1], ',') {
+			if strings.TrimSpace(e) != "" && !implements(e, derived) {
+				return false
+			}
+		}
+		return true
+	case strings.HasPrefix(t, "[") && strings.HasSuffix(t, "]"):
+		return implements(rust.SplitTop(t[1:len(t)-1], ';')[0], derived)
+	case strings.HasPrefix(t, "impl ") || strings.HasPrefix(t, "dyn "):
+		return false
+	}
+	base := rust.BaseName(t)
+	if primitives[base] {
+		return true
+	}
+	if containers[base] {
+		_, args := rust.SplitGeneric(t)
+		for _, a := range args {
+			if !strings.HasPrefix(a, "'") && !implements(a, derived) {
+				return false
+			}
+		}
+		return true
+	}
+	return derived[base]
+}
+
+// copyable reports whether values of type t are known to be Copy, so they
+// can be used repeatedly without cloning.
+func copyable(t string) bool {
+	t = strings.TrimSpace(t)
+	switch {
+	case t == "()" || isStatic(t):
+		return true
+	case strings.HasPrefix(t, "(") && strings.HasSuffix(t, ")"):
+		for _, e := range rust.SplitTop(t[1:len(t)-1], ',') {
+			if strings.TrimSpace(e) != "" && !copyable(e) {
+				return false
+			}
+		}
+		return true
+	}
+	switch t {
+	case "i8", "i16", "i32", "i64", "i128", "isize", "u8", "u16", "u32", "u64",
+		"u128", "usize", "f32", "f64", "bool", "char":
+		return true
+	}
+	return false
+}
+
+// derefType removes a leading reference, with its lifetime and mutability,
+// from t. &'a mut str gives str.
+func derefType(t string) string {
+	t = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(t), "&"))
+	if strings.HasPrefix(t, "'") {
+		if i := strings.IndexAny(t, " \t\n"); i != -1 {
+			t = strings.TrimSpace(t[i:])
+		}
+	}
+	t = strings.TrimPrefix(t, "mut ")
+	return strings.TrimSpace(t)
+}
+
+// isStatic reports whether t is a reference with a 'static lifetime, which can
+// be stored as it is.
+func isStatic(t string) bool {
+	t = strings.TrimSpace(t)
+	return strings.HasPrefix(t, "&") && strings.HasPrefix(strings.TrimSpace(t[1:]), "'static")
+}
+
+// ownedType maps a parameter type to a type which owns its data, so that it
+// can be kept in a struct without a lifetime. &str gives String, &[T] gives
+// Vec<T> and &T gives T.
+func ownedType(t string) string {
+	t = strings.TrimSpace(t)
+	if strings.HasPrefix(t, "impl ") {
+		head, args := rust.SplitGeneric(strings.TrimPrefix(t, "impl "))
+		if len(args) == 1 {
+			switch rust.BaseName(head) {
+			case "AsRef":
+				return ownedType("&" + args[0])
+			case "Into":
+				return ownedType(args[0])
+			}
+		}
+		return t
+	}
+	if !strings.HasPrefix(t, "&") || isStatic(t) {
+		return staticLifetimes(t)
+	}
+	inner := derefType(t)
+	switch base := rust.BaseName(inner); {
+	case base == "str":
+		return "String"
+	case base == "Path":
+		return "std::path::PathBuf"
+	case base == "OsStr":
+		return "std::ffi::OsString"
+	case base == "CStr":
+		return "std::ffi::CString"
+	case strings.HasPrefix(inner, "[") && !strings.Contains(inner, ";"):
+		return "Vec<" + ownedType(inner[1:len(inner)-1]) + ">"
+	case strings.HasPrefix(inner, "dyn "):
+		return "Box<" + staticLifetimes(inner) + ">"
+	}
+	return ownedType(inner)
+}
+
+// borrowOf gives the operator which turns the owned type of a parameter back
+// into its declared type at the call site, ie. & for &str.
+func borrowOf(t string) string {
+	t = strings.TrimSpace(t)
+	if strings.HasPrefix(t, "impl AsRef") {
+		return "&"
+	}
+	if !strings.HasPrefix(t, "&") || isStatic(t) {
+		return ""
+	}
+	rest := strings.TrimSpace(t[1:])
+	if strings.HasPrefix(rest, "'") {
+		if i := strings.IndexAny(rest, " \t\n"); i != -1 {
+			rest = strings.TrimSpace(rest[i:])
+		}
+	}
+	if strings.HasPrefix(rest, "mut ") {
+		return "&mut "
+	}
+	return "&"
+}
+
+var lifetimePattern = regexp.MustCompile(`'[A-Za-z_][A-Za-z0-9_]*`)
+
+// staticLifetimes replaces named lifetimes with 'static, since a test case has
+// nothing else to borrow from.
+func staticLifetimes(t string) string {
+	return lifetimePattern.ReplaceAllString(t, "'static")
+}
+
+// elidedLifetimes drops the lifetimes of the argument types of a function
+// pointer, so that it takes values borrowed for any lifetime.
+func elidedLifetimes(t string) string {
+	t = regexp.MustCompile(`&'[A-Za-z_][A-Za-z0-9_]*\s*`).ReplaceAllString(t, "&")
+	return lifetimePattern.ReplaceAllString(t, "'_")
+}
+
+// argType gives the type from a function argument, ie. name: type
+func argType(arg string) string {
+	i := strings.Index(arg, ":")
+	if i == -1 {
+		return ""
+	}
+	return strings.TrimSpace(arg[i+1:])
+}
@@ -0,0 +1,486 @@
+package cmd
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/skreimeyer/rustbuddy/rust"
+	"github.com/spf13/cobra"
+)
+
+// unsafeAuditCmd represents the unsafe-audit command
+var unsafeAuditCmd = &cobra.Command{
+	Use:   "unsafe-audit [flags] [PATH]",
+	Short: "List all unsafe code in a crate",
+	Long: `Unsafe-audit walks a crate (or a single file) and lists every unsafe
+block, fn and impl along with its location and the item that encloses it. Any
+unsafe code without a justification is flagged. A justification is a comment
+containing "SAFETY:" directly above the unsafe code, or a "# Safety" section in
+the docs of an unsafe fn:
+
+	// SAFETY: the index is checked above.
+	let x = unsafe { *ptr.add(i) };
+
+A count of unsafe items and lines is given for each module. Output is a table
+by default, but JSON and SARIF are available for tooling with --format.
+
+Approved unsafe code can be recorded in a baseline file with --update-baseline.
+Entries are keyed by item path and a hash of the code with whitespace
+normalized, so moving code around does not invalidate them. With --check, the
+audit exits with an error when unsafe code is added, an approved block is
+changed or a file cannot be parsed, which makes it suitable for CI.
+
+PATH defaults to the current directory.`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		auditUnsafe(args)
+	},
+}
+
+var auditFormat string
+var auditBaseline string
+var auditCheck bool
+var auditUpdate bool
+
+func init() {
+	rootCmd.AddCommand(unsafeAuditCmd)
+	unsafeAuditCmd.Flags().StringVar(&auditFormat, "format", "table", "output format: table, json or sarif")
+	unsafeAuditCmd.Flags().StringVar(&auditBaseline, "baseline", "unsafe-baseline.json", "path to the baseline of approved unsafe code")
+	unsafeAuditCmd.Flags().BoolVar(&auditCheck, "check", false, "fail if unsafe code is not in the baseline")
+	unsafeAuditCmd.Flags().BoolVar(&auditUpdate, "update-baseline", false, "approve all current unsafe code by writing the baseline")
+}
+
+// unsafeItem is a single use of unsafe found by the audit
+type unsafeItem struct {
+	File   string `json:"file"`
+	Line   int    `json:"line"`
+	Column int    `json:"column"`
+	Kind   string `json:"kind"`
+	Path   string `json:"path"`
+	Lines  int    `json:"lines"`
+	Safety bool   `json:"safety_comment"`
+	Hash   string `json:"hash"`
+}
+
+// moduleCount totals the unsafe usage within a single module
+type moduleCount struct {
+	Module string `json:"module"`
+	Items  int    `json:"items"`
+	Lines  int    `json:"lines"`
+}
+
+func auditUnsafe(args []string) {
+	target := "."
+	if len(args) > 0 {
+		target = args[0]
+	}
+	items, counts, skipped, err := collectUnsafe(target)
+	if err != nil {
+		fmt.Println(err)
+		if auditCheck {
+			os.Exit(1)
+		}
+		return
+	}
+	if len(skipped) > 0 {
+		fmt.Printf("%d files could not be audited\n", len(skipped))
+	}
+	if auditUpdate {
+		if len(skipped) > 0 { // a baseline of part of the crate would be wrong
+			return
+		}
+		err = writeBaseline(auditBaseline, items)
+		if err != nil {
+			fmt.Println("Cannot write baseline:", err)
+			return
+		}
+		fmt.Printf("Approved %d unsafe items in %s\n", len(items), auditBaseline)
+		return
+	}
+	if auditCheck {
+		// A check cannot pass without seeing every file
+		if !checkBaseline(auditBaseline, items, skipped) || len(skipped) > 0 {
+			os.Exit(1)
+		}
+		return
+	}
+	switch auditFormat {
+	case "table":
+		printUnsafeTable(items, counts)
+	case "json":
+		report := struct {
+			Items   []unsafeItem  `json:"items"`
+			Modules []moduleCount `json:"modules"`
+		}{items, counts}
+		writeJSON(report)
+	case "sarif":
+		writeJSON(unsafeSarif(items))
+	default:
+		fmt.Println("Unknown format:", auditFormat)
+	}
+}
+
+// collectUnsafe parses every rust file at target and gathers the unsafe items
+// in each. Items are named by their module path so they can be found again
+// after the code around them moves. Files which cannot be read or parsed, ie.
+// because their brackets do not balance, are printed and skipped, and their
+// modules are returned.
+func collectUnsafe(target string) ([]unsafeItem, []moduleCount, []string, error) {
+	var items []unsafeItem
+	info, err := os.Stat(target)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	files := []string{target}
+	base := filepath.Dir(target)
+	if info.IsDir() {
+		base = target
+		files, err = rustFiles(target)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+	}
+	root, err := findCrate(base)
+	if err != nil {
+		root, _ = filepath.Abs(base)
+	}
+	modules := make(map[string]*moduleCount)
+	var skipped []string
+	for _, fname := range files {
+		abs, _ := filepath.Abs(fname)
+		mod := modulePath(root, abs)
+		content, err := ioutil.ReadFile(fname)
+		if err != nil {
+			fmt.Println("File Read error:", err)
+			skipped = append(skipped, mod)
+			continue
+		}
+		f, err := os.Open(fname)
+		if err != nil {
+			fmt.Println("File Read error:", err)
+			skipped = append(skipped, mod)
+			continue
+		}
+		src, err := rust.Parse(f)
+		f.Close()
+		if err != nil {
+			fmt.Println("Parsing error:", err)
+			skipped = append(skipped, mod)
+			continue
+		}
+		lines := strings.Split(string(content), "\n")
+		for _, u := range src.UB {
+			path := mod
+			if u.Item != "" {
+				path += "::" + u.Item
+			}
+			item := unsafeItem{
+				File:   filepath.ToSlash(fname),
+				Line:   u.Span.Start.Line,
+				Column: u.Span.Start.Column,
+				Kind:   u.Kind,
+				Path:   path,
+				Lines:  u.Span.End.Line - u.Span.Start.Line + 1,
+				Safety: hasSafetyComment(lines, u.Span.Start.Line),
+				Hash:   hashUnsafe(content[u.Span.Start.Offset:u.Span.End.Offset]),
+			}
+			items = append(items, item)
+			if modules[mod] == nil {
+				modules[mod] = &moduleCount{Module: mod}
+			}
+			modules[mod].Items++
+			if !nestedUnsafe(u, src.UB) {
+				modules[mod].Lines += item.Lines
+			}
+		}
+	}
+	counts := []moduleCount{}
+	for _, c := range modules {
+		counts = append(counts, *c)
+	}
+	sort.Slice(counts, func(i, j int) bool { return counts[i].Module < counts[j].Module })
+	return items, counts, skipped, nil
+}
+
+// inModules reports whether the item path is within one of modules
+func inModules(path string, modules []string) bool {
+	for _, m := range modules {
+		if path == m || strings.HasPrefix(path, m+"::") {
+			return true
+		}
+	}
+	return false
+}
+
+// nestedUnsafe reports whether u lies within another of the unsafe items ubs,
+// such as a block in an unsafe fn, whose lines are already counted
+func nestedUnsafe(u rust.Unsafe, ubs []rust.Unsafe) bool {
+	for _, o := range ubs {
+		if o.Span == u.Span {
+			continue
+		}
+		if o.Span.Start.Offset <= u.Span.Start.Offset && u.Span.End.Offset <= o.Span.End.Offset {
+			return true
+		}
+	}
+	return false
+}
+
+// hasSafetyComment reports whether the unsafe code starting on line is
+// justified by a SAFETY comment on the same line or the comment lines directly
+// above it. Attributes between the comment and the code are skipped.
+func hasSafetyComment(lines []string, line int) bool {
+	if line < 1 || line > len(lines) {
+		return false
+	}
+	if strings.Contains(lines[line-1], "SAFETY:") {
+		return true
+	}
+	for i := line - 2; i >= 0; i-- {
+		l := strings.TrimSpace(lines[i])
+		if strings.HasPrefix(l, "#[") {
+			continue
+		}
+		if !strings.HasPrefix(l, "//") && !strings.HasPrefix(l, "/*") {
+			break
+		}
+		if strings.Contains(l, "SAFETY:") {
+			return true
+		}
+		if strings.HasPrefix(l, "///") && strings.TrimSpace(l[3:]) == "# Safety" {
+			return true
+		}
+	}
+	return false
+}
+
+// hashUnsafe hashes a block of code with all whitespace collapsed, so that
+// reindenting or reflowing code does not change the result.
+func hashUnsafe(code []byte) string {
+	normal := strings.Join(strings.Fields(string(code)), " ")
+	sum := sha256.Sum256([]byte(normal))
+	return hex.EncodeToString(sum[:])[:16]
+}
+
+// approval is an entry in the baseline of unsafe code that has been reviewed
+type approval struct {
+	Path string `json:"path"`
+	Kind string `json:"kind"`
+	Hash string `json:"hash"`
+}
+
+func writeBaseline(fname string, items []unsafeItem) error {
+	baseline := struct {
+		Approved []approval `json:"approved"`
+	}{[]approval{}}
+	for _, i := range items {
+		baseline.Approved = append(baseline.Approved, approval{i.Path, i.Kind, i.Hash})
+	}
+	b, err := json.MarshalIndent(baseline, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(fname, append(b, '\n'), 0644)
+}
+
+// checkBaseline compares the current unsafe items with the approved items in
+// the baseline. Items that are new or have changed since approval are printed
+// and false is returned. Approvals within the skipped modules, whose files
+// could not be audited, are not reported as stale.
+func checkBaseline(fname string, items []unsafeItem, skipped []string) bool {
+	var baseline struct {
+		Approved []approval `json:"approved"`
+	}
+	content, err := ioutil.ReadFile(fname)
+	if err != nil && !os.IsNotExist(err) {
+		fmt.Println("Cannot read baseline:", err)
+		return false
+	}
+	if err == nil {
+		if err := json.Unmarshal(content, &baseline); err != nil {
+			fmt.Println("Cannot parse baseline:", err)
+			return false
+		}
+	}
+	// The same code may legitimately appear more than once in an item, so
+	// approvals are counted rather than just flagged.
+	approved := make(map[string]int)
+	paths := make(map[string]int)
+	for _, a := range baseline.Approved {
+		approved[a.Path+" "+a.Hash]++
+		paths[a.Path]++
+	}
+	var unmatched []unsafeItem
+	for _, i := range items {
+		key := i.Path + " " + i.Hash
+		if approved[key] > 0 {
+			approved[key]--
+			paths[i.Path]--
+			continue
+		}
+		unmatched = append(unmatched, i)
+	}
+	var failed []string
+	for _, i := range unmatched {
+		status := "new"
+		if paths[i.Path] > 0 {
+			status = "changed"
+			paths[i.Path]--
+		}
+		failed = append(failed, fmt.Sprintf("%-8s unsafe %s in %s (%s:%d:%d)", status, i.Kind, i.Path, i.File, i.Line, i.Column))
+	}
+	stale := 0
+	for p, n := range paths {
+		if !inModules(p, skipped) {
+			stale += n
+		}
+	}
+	for _, f := range failed {
+		fmt.Println(f)
+	}
+	if stale > 0 {
+		fmt.Printf("%d approved items no longer exist. Prune them with --update-baseline\n", stale)
+	}
+	if len(failed) > 0 {
+		fmt.Printf("%d unsafe items are not approved in %s\n", len(failed), fname)
+		return false
+	}
+	fmt.Printf("All %d unsafe items are approved\n", len(items))
+	return true
+}
+
+func printUnsafeTable(items []unsafeItem, counts []moduleCount) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	missing := 0
+	fmt.Fprintln(w, "LOCATION\tKIND\tITEM\tLINES\tSAFETY")
+	for _, i := range items {
+		safety := "yes"
+		if !i.Safety {
+			safety = "MISSING"
+			missing++
+		}
+		fmt.Fprintf(w, "%s:%d:%d\t%s\t%s\t%d\t%s\n", i.File, i.Line, i.Column, i.Kind, i.Path, i.Lines, safety)
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "MODULE\tUNSAFE\tLINES")
+	for _, c := range counts {
+		fmt.Fprintf(w, "%s\t%d\t%d\n", c.Module, c.Items, c.Lines)
+	}
+	w.Flush()
+	fmt.Printf("\n%d unsafe items, %d without a SAFETY comment\n", len(items), missing)
+}
+
+func writeJSON(v interface{}) {
+	b, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		fmt.Println("Cannot encode output:", err)
+		return
+	}
+	os.Stdout.Write(b)
+	fmt.Println()
+}
+
+// The subset of SARIF 2.1.0 needed to report results with a location.
+type sarifLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool    sarifTool     `json:"tool"`
+	Results []sarifResult `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name           string      `json:"name"`
+	InformationURI string      `json:"informationUri"`
+	Rules          []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID               string       `json:"id"`
+	ShortDescription sarifMessage `json:"shortDescription"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifResult struct {
+	RuleID    string          `json:"ruleId"`
+	Level     string          `json:"level"`
+	Message   sarifMessage    `json:"message"`
+	Locations []sarifLocation `json:"locations"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation sarifPhysical `json:"physicalLocation"`
+}
+
+type sarifPhysical struct {
+	ArtifactLocation sarifArtifact `json:"artifactLocation"`
+	Region           sarifRegion   `json:"region"`
+}
+
+type sarifArtifact struct {
+	URI string `json:"uri"`
+}
+
+type sarifRegion struct {
+	StartLine   int `json:"startLine"`
+	StartColumn int `json:"startColumn"`
+	EndLine     int `json:"endLine"`
+}
+
+func unsafeSarif(items []unsafeItem) sarifLog {
+	run := sarifRun{
+		Tool: sarifTool{Driver: sarifDriver{
+			Name:           "rustbuddy",
+			InformationURI: "https://github.com/skreimeyer/rustbuddy",
+			Rules: []sarifRule{
+				{ID: "unsafe-code", ShortDescription: sarifMessage{"Use of unsafe code"}},
+				{ID: "unsafe-missing-safety", ShortDescription: sarifMessage{"Unsafe code without a SAFETY comment"}},
+			},
+		}},
+		Results: []sarifResult{},
+	}
+	for _, i := range items {
+		r := sarifResult{
+			RuleID:  "unsafe-code",
+			Level:   "note",
+			Message: sarifMessage{fmt.Sprintf("unsafe %s in %s", i.Kind, i.Path)},
+			Locations: []sarifLocation{{PhysicalLocation: sarifPhysical{
+				ArtifactLocation: sarifArtifact{URI: i.File},
+				Region: sarifRegion{
+					StartLine:   i.Line,
+					StartColumn: i.Column,
+					EndLine:     i.Line + i.Lines - 1,
+				},
+			}}},
+		}
+		if !i.Safety {
+			r.RuleID = "unsafe-missing-safety"
+			r.Level = "warning"
+			r.Message.Text += " has no SAFETY comment"
+		}
+		run.Results = append(run.Results, r)
+	}
+	return sarifLog{
+		Schema:  "https://json.schemastore.org/sarif-2.1.0.json",
+		Version: "2.1.0",
+		Runs:    []sarifRun{run},
+	}
+}
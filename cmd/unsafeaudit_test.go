@@ -0,0 +1,182 @@
+package cmd
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const unsafeSample = `pub struct Counter {
+    n: *mut u32,
+}
+
+impl Counter {
+    /// # Safety
+    ///
+    /// n must be valid.
+    pub unsafe fn raw(&self) -> u32 {
+        // SAFETY: valid by contract.
+        unsafe { *self.n }
+    }
+}
+
+fn main() {
+    // SAFETY: the pointer is checked.
+    let _ = unsafe { 1 };
+}
+`
+
+func TestCollectUnsafeNested(t *testing.T) {
+	root := tempCrate(t)
+	defer os.RemoveAll(root)
+	fname := filepath.Join(root, "src", "main.rs")
+	os.MkdirAll(filepath.Dir(fname), 0755)
+	if err := ioutil.WriteFile(fname, []byte(unsafeSample), 0644); err != nil {
+		t.Fatal(err)
+	}
+	items, counts, _, err := collectUnsafe(filepath.Join(root, "src"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	paths := []string{"crate::Counter::raw", "crate::Counter::raw", "crate::main"}
+	if len(items) != len(paths) {
+		t.Fatalf("Expected %d unsafe items. Found %v", len(paths), items)
+	}
+	for i, p := range paths {
+		if items[i].Path != p {
+			t.Errorf("Expected %s. Found %s", p, items[i].Path)
+		}
+	}
+	// the block inside raw is not counted a second time
+	if len(counts) != 1 || counts[0].Items != 3 || counts[0].Lines != 5 {
+		t.Errorf("Expected 3 items over 5 lines. Found %+v", counts)
+	}
+}
+
+func TestCollectUnsafeSkipped(t *testing.T) {
+	root := tempCrate(t, "src/main.rs")
+	defer os.RemoveAll(root)
+	// a dangling link cannot be read, and a brace which is never closed
+	// cannot be parsed
+	if err := os.Symlink(filepath.Join(root, "missing.rs"), filepath.Join(root, "src", "gone.rs")); err != nil {
+		t.Fatal(err)
+	}
+	broken := "fn f() {\n    unsafe { g() }\n    let c = '{';\n"
+	if err := ioutil.WriteFile(filepath.Join(root, "src", "broken.rs"), []byte(broken), 0644); err != nil {
+		t.Fatal(err)
+	}
+	_, counts, skipped, err := collectUnsafe(filepath.Join(root, "src"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(skipped, " ") != "crate::broken crate::gone" {
+		t.Errorf("Expected crate::broken and crate::gone to be skipped. Found %v", skipped)
+	}
+	if counts == nil {
+		t.Error("Expected the results of the readable files")
+	}
+}
+
+func TestHashUnsafe(t *testing.T) {
+	a := hashUnsafe([]byte("unsafe {\n    *p\n}"))
+	b := hashUnsafe([]byte("unsafe { *p }"))
+	c := hashUnsafe([]byte("unsafe { *q }"))
+	if a != b {
+		t.Errorf("Expected reindented code to hash the same. Found %s and %s", a, b)
+	}
+	if a == c {
+		t.Errorf("Expected changed code to hash differently. Found %s", a)
+	}
+}
+
+func TestCheckBaseline(t *testing.T) {
+	dir, err := ioutil.TempDir("", "baseline")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	fname := filepath.Join(dir, "unsafe-baseline.json")
+	approved := []unsafeItem{
+		{File: "src/lib.rs", Line: 3, Kind: "block", Path: "crate::read", Hash: "aaaa"},
+		{File: "src/lib.rs", Line: 9, Kind: "fn", Path: "crate::write", Hash: "bbbb"},
+	}
+	if err := writeBaseline(fname, approved); err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		name  string
+		items []unsafeItem
+		pass  bool
+	}{
+		{"unchanged", approved, true},
+		{"moved", []unsafeItem{
+			{File: "src/io.rs", Line: 30, Kind: "block", Path: "crate::read", Hash: "aaaa"},
+			{File: "src/io.rs", Line: 40, Kind: "fn", Path: "crate::write", Hash: "bbbb"},
+		}, true},
+		{"stale", approved[:1], true},
+		{"changed", []unsafeItem{
+			approved[0],
+			{File: "src/lib.rs", Line: 9, Kind: "fn", Path: "crate::write", Hash: "cccc"},
+		}, false},
+		{"new", append([]unsafeItem{
+			{File: "src/lib.rs", Line: 20, Kind: "block", Path: "crate::flush", Hash: "dddd"},
+		}, approved...), false},
+		{"repeated", append([]unsafeItem{approved[0]}, approved...), false},
+	}
+	for _, c := range cases {
+		if pass := checkBaseline(fname, c.items, nil); pass != c.pass {
+			t.Errorf("%s: checkBaseline = %t, want %t", c.name, pass, c.pass)
+		}
+	}
+	if checkBaseline(filepath.Join(dir, "none.json"), approved, nil) {
+		t.Error("Expected unsafe code to fail without a baseline")
+	}
+	if !checkBaseline(filepath.Join(dir, "none.json"), nil, nil) {
+		t.Error("Expected no unsafe code to pass without a baseline")
+	}
+}
+
+func TestCheckBaselineSkipped(t *testing.T) {
+	dir, err := ioutil.TempDir("", "baseline")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	fname := filepath.Join(dir, "unsafe-baseline.json")
+	approved := []unsafeItem{
+		{Kind: "block", Path: "crate::net::read", Hash: "aaaa"},
+		{Kind: "block", Path: "crate::main", Hash: "bbbb"},
+	}
+	if err := writeBaseline(fname, approved); err != nil {
+		t.Fatal(err)
+	}
+	out := captureStdout(t, func() {
+		if !checkBaseline(fname, approved[1:], []string{"crate::net"}) {
+			t.Error("Expected the audited items to pass")
+		}
+	})
+	if strings.Contains(out, "no longer exist") {
+		t.Errorf("Expected no stale items for a skipped module. Found:\n%s", out)
+	}
+	out = captureStdout(t, func() { checkBaseline(fname, approved[1:], nil) })
+	if !strings.Contains(out, "1 approved items no longer exist") {
+		t.Errorf("Expected a stale item. Found:\n%s", out)
+	}
+}
+
+// captureStdout gives what f prints
+func captureStdout(t *testing.T, f func()) string {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	f()
+	os.Stdout = stdout
+	w.Close()
+	out, _ := ioutil.ReadAll(r)
+	return string(out)
+}
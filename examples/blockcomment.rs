@@ -5,7 +5,7 @@ on several lines
 This file only has a main function
 */
 
-use std::f64::consts::PI
+use std::f64::consts::PI;
 
 fn main() {
     println!("Hello, world!");
@@ -5,35 +5,43 @@ on several lines
 This file only has a main function
 */
 
-use std::error::Error;
-use std::fmt;
+use std::f64::consts::PI;
 
 #[derive(Debug)]
-struct MyCustomErrorName {
-    message: String
+#[non_exhaustive]
+pub enum BlockcommentError {
+    Other {
+        message: String,
+    },
 }
 
-impl MyCustomErrorName {
-    fn new(message: &str) -> MyCustomErrorName {
-        MyCustomErrorName{message: message.to_string()}
+/// Result of the operations of this module
+pub type Result<T, E = BlockcommentError> = std::result::Result<T, E>;
+
+impl BlockcommentError {
+    pub fn new(message: &str) -> Self {
+        BlockcommentError::Other {
+            message: message.to_string(),
+        }
     }
 }
 
-impl fmt::Display for MyCustomErrorName {
-    fn fmt(&self, f: &mut fmt::Formatter) -> fmt::Result {
-        write!(f,"{}",self.message)
+impl std::fmt::Display for BlockcommentError {
+    fn fmt(&self, f: &mut std::fmt::Formatter<'_>) -> std::fmt::Result {
+        match self {
+            BlockcommentError::Other { message, .. } => f.write_str(message),
+        }
     }
 }
 
-impl Error for MyCustomErrorName {
-    fn description(&self) -> &str {
-        &self.message
+impl std::error::Error for BlockcommentError {
+    fn source(&self) -> Option<&(dyn std::error::Error + 'static)> {
+        match self {
+            BlockcommentError::Other { .. } => None,
+        }
     }
 }
 
-
-use std::f64::consts::PI
-
 fn main() {
     println!("Hello, world!");
     println!("In case you didn't know, pi is {}",PI)
@@ -1,33 +1,41 @@
 //! Just a comment
 //! Second line
 
-use std::error::Error;
-use std::fmt;
-
 #[derive(Debug)]
-struct simplesourceError {
-    message: String
+#[non_exhaustive]
+pub enum SimplesourceError {
+    Other {
+        message: String,
+    },
 }
 
-impl simplesourceError {
-    fn new(message: &str) -> simplesourceError {
-        simplesourceError{message: message.to_string()}
+/// Result of the operations of this module
+pub type Result<T, E = SimplesourceError> = std::result::Result<T, E>;
+
+impl SimplesourceError {
+    pub fn new(message: &str) -> Self {
+        SimplesourceError::Other {
+            message: message.to_string(),
+        }
     }
 }
 
-impl fmt::Display for simplesourceError {
-    fn fmt(&self, f: &mut fmt::Formatter) -> fmt::Result {
-        write!(f,"{}",self.message)
+impl std::fmt::Display for SimplesourceError {
+    fn fmt(&self, f: &mut std::fmt::Formatter<'_>) -> std::fmt::Result {
+        match self {
+            SimplesourceError::Other { message, .. } => f.write_str(message),
+        }
     }
 }
 
-impl Error for simplesourceError {
-    fn description(&self) -> &str {
-        &self.message
+impl std::error::Error for SimplesourceError {
+    fn source(&self) -> Option<&(dyn std::error::Error + 'static)> {
+        match self {
+            SimplesourceError::Other { .. } => None,
+        }
     }
 }
 
-
 fn main() {
     println!("Hello, world!");
     let x = 5;
@@ -1,27 +1,35 @@
-
-use std::error::Error;
-use std::fmt;
-
 #[derive(Debug)]
-struct SomeErrorName {
-    message: String
+#[non_exhaustive]
+pub enum StructsandmethodsError {
+    Other {
+        message: String,
+    },
 }
 
-impl SomeErrorName {
-    fn new(message: &str) -> SomeErrorName {
-        SomeErrorName{message: message.to_string()}
+/// Result of the operations of this module
+pub type Result<T, E = StructsandmethodsError> = std::result::Result<T, E>;
+
+impl StructsandmethodsError {
+    pub fn new(message: &str) -> Self {
+        StructsandmethodsError::Other {
+            message: message.to_string(),
+        }
     }
 }
 
-impl fmt::Display for SomeErrorName {
-    fn fmt(&self, f: &mut fmt::Formatter) -> fmt::Result {
-        write!(f,"{}",self.message)
+impl std::fmt::Display for StructsandmethodsError {
+    fn fmt(&self, f: &mut std::fmt::Formatter<'_>) -> std::fmt::Result {
+        match self {
+            StructsandmethodsError::Other { message, .. } => f.write_str(message),
+        }
     }
 }
 
-impl Error for SomeErrorName {
-    fn description(&self) -> &str {
-        &self.message
+impl std::error::Error for StructsandmethodsError {
+    fn source(&self) -> Option<&(dyn std::error::Error + 'static)> {
+        match self {
+            StructsandmethodsError::Other { .. } => None,
+        }
     }
 }
 
@@ -45,7 +53,7 @@ pub trait HasArea {
 }
 
 impl HasArea for Rectangle {
-    pub fn area(&self) -> i32 {
+    fn area(&self) -> i32 {
         let height = (self.b.y - self.a.y).abs();
         let width = (self.b.x - self.a.x).abs();
         return height * width;
@@ -53,8 +61,8 @@ impl HasArea for Rectangle {
 }
 
 impl HasArea for Circle {
-    pub fn area(&self) -> i32 {
+    fn area(&self) -> i32 {
         let farea = std::f64::consts::PI * f64::from(self.radius).powi(2);
-        return std::i32::from(farea);
+        return farea as i32;
     }
 }
@@ -18,7 +18,7 @@ pub trait HasArea {
 }
 
 impl HasArea for Rectangle {
-    pub fn area(&self) -> i32 {
+    fn area(&self) -> i32 {
         let height = (self.b.y - self.a.y).abs();
         let width = (self.b.x - self.a.x).abs();
         return height * width;
@@ -26,9 +26,9 @@ impl HasArea for Rectangle {
 }
 
 impl HasArea for Circle {
-    pub fn area(&self) -> i32 {
+    fn area(&self) -> i32 {
         let farea = std::f64::consts::PI * f64::from(self.radius).powi(2);
-        return std::i32::from(farea);
+        return farea as i32;
     }
 }
 
@@ -36,59 +36,63 @@ impl HasArea for Circle {
 mod tests {
 	use super::*;
 
+	// generated code. Edit only test cases!
+	// functions
+	
+	// methods
 	#[test]
-	fn test_HasAreaRectanglearea() {
-		
+	fn test_Rectangle_HasArea_area() {
+		#[derive(PartialEq)]
 		struct Output {
-			R: i32
-		};
+			r: i32,
+		}
 		struct Case { 
-			obj: Rectangle
-			inpt: Input,
-			out: Output,
-			comment: string,
-		};
+			obj:		Rectangle,
+			out:		Output,
+			comment:	String,
+		}
 		// __TEST CASES GO HERE__
-		let cases = vec![
+		let cases: Vec<Case> = vec![
 			// FIXME
 			// Case { 
-			//	obj: Rectangle{}
-			// 	inpt: Input {},
-			// 	out: Output{},
-			// 	comment: "",
+			//	obj: 	Rectangle{},
+			// 	out: 	Output{r: },
+			// 	comment:String::from(""),
 			// },
-		]
+		];
 		// __END TEST CASES__
-		for c in cases.iter() {
-			assert!(c.obj.area() == c.out, c.comment)
+		for c in cases.into_iter() { 
+			assert!(
+				Output{r: <Rectangle as HasArea>::area(&c.obj)} == c.out, "{}", c.comment
+			);
 		}
 	}
 	#[test]
-	fn test_HasAreaCirclearea() {
-		
+	fn test_Circle_HasArea_area() {
+		#[derive(PartialEq)]
 		struct Output {
-			R: i32
-		};
+			r: i32,
+		}
 		struct Case { 
-			obj: Circle
-			inpt: Input,
-			out: Output,
-			comment: string,
-		};
+			obj:		Circle,
+			out:		Output,
+			comment:	String,
+		}
 		// __TEST CASES GO HERE__
-		let cases = vec![
+		let cases: Vec<Case> = vec![
 			// FIXME
 			// Case { 
-			//	obj: Circle{}
-			// 	inpt: Input {},
-			// 	out: Output{},
-			// 	comment: "",
+			//	obj: 	Circle{},
+			// 	out: 	Output{r: },
+			// 	comment:String::from(""),
 			// },
-		]
+		];
 		// __END TEST CASES__
-		for c in cases.iter() {
-			assert!(c.obj.area() == c.out, c.comment)
+		for c in cases.into_iter() { 
+			assert!(
+				Output{r: <Circle as HasArea>::area(&c.obj)} == c.out, "{}", c.comment
+			);
 		}
 	}
 	
-}
+	}//End generated code
@@ -1,3 +1,6 @@
+//! Just a comment
+//! Second line
+
 fn main() {
     println!("Hello, world!");
     let x = 5;
@@ -13,33 +16,40 @@ fn add(a: i32, b: i32) -> i32 {
 mod tests {
 	use super::*;
 
+	// generated code. Edit only test cases!
+	// functions
 	#[test]
 	fn test_add() {
 		struct Input {
 			a: i32,
-			 b: i32,
-			};
+			b: i32,
+			}
+		#[derive(PartialEq)]
 		struct Output {
-			R: i32
-		};
+			r: i32,
+		}
 		struct Case { 
-			inpt: Input,
-			out: Output,
-			comment: string,
-		};
+			input:		Input,
+			out:		Output,
+			comment:	String,
+		}
 		// __TEST CASES GO HERE__
-		let cases = vec![
+		let cases: Vec<Case> = vec![
 			// FIXME
 			// Case { 
-			// 	inpt: Input {},
-			// 	out: Output{},
-			// 	comment: "",
+			//	input:	Input{},
+			// 	out: 	Output{r: },
+			// 	comment:String::from(""),
 			// },
-		]
+		];
 		// __END TEST CASES__
-		for c in cases.iter() {
-			assert!(add(c.inpt.a,c.inpt.b,) == c.out, c.comment)
+		for c in cases.into_iter() { 
+			assert!(
+				Output{r: add(c.input.a, c.input.b)} == c.out, "{}", c.comment
+			);
 		}
 	}
 	
-}
+	
+	
+	}//End generated code
@@ -18,7 +18,7 @@ pub trait HasArea {
 }
 
 impl HasArea for Rectangle {
-    pub fn area(&self) -> i32 {
+    fn area(&self) -> i32 {
         let height = (self.b.y - self.a.y).abs();
         let width = (self.b.x - self.a.x).abs();
         return height * width;
@@ -26,8 +26,8 @@ impl HasArea for Rectangle {
 }
 
 impl HasArea for Circle {
-    pub fn area(&self) -> i32 {
+    fn area(&self) -> i32 {
         let farea = std::f64::consts::PI * f64::from(self.radius).powi(2);
-        return std::i32::from(farea);
+        return farea as i32;
     }
 }
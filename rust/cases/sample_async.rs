@@ -0,0 +1,15 @@
+pub async fn fetch(url: &str) -> Result<String, String> {
+    Ok(url.to_string())
+}
+
+fn blocking() -> u8 {
+    1
+}
+
+struct Client;
+
+impl Client {
+    pub(crate) async fn get(&self, path: &str) -> Option<String> {
+        fetch(path).await.ok()
+    }
+}
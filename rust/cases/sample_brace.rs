@@ -0,0 +1,18 @@
+fn open(c: char) -> bool {
+    // a { in a comment
+    /* and } in a block comment */
+    c == '{' || c == '\'' || "{".starts_with(c) || r#"}"#.len() == 1
+}
+
+fn label<'a>(s: &'a str) -> &'a str {
+    if s.is_empty() {
+        "}"
+    } else {
+        s
+    }
+}
+
+unsafe fn first(p: *const u8) -> u8 {
+    let b = b'{';
+    *p + b
+}
@@ -0,0 +1,17 @@
+#[cfg(test)]
+struct Fixture;
+
+mod util {
+    pub fn one() -> u8 {
+        1
+    }
+}
+
+#[cfg(test)]
+const SEED: u64 = 7;
+
+mod more {
+    pub fn two() -> u8 {
+        2
+    }
+}
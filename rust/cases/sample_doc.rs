@@ -0,0 +1,40 @@
+//! Crate docs are not item docs
+
+/// Adds two numbers.
+///
+/// # Examples
+///
+/// ```
+/// assert_eq!(add(1, 2), 3);
+/// ```
+pub fn add(a: i32, b: i32) -> i32 {
+    a + b
+}
+
+/// Not attached to anything
+const LIMIT: i32 = 10;
+
+// A plain comment
+fn plain() {}
+
+/// Multiplies two numbers.
+#[inline]
+pub(crate) fn mul(a: i32, b: i32) -> i32 {
+    a * b
+}
+
+pub struct Counter {
+    n: i32,
+}
+
+impl Counter {
+    /// Counts one more.
+    #[inline]
+    pub fn incr(&mut self) {
+        self.n += 1;
+    }
+
+    fn get(&self) -> i32 {
+        self.n
+    }
+}
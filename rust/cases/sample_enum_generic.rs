@@ -0,0 +1,12 @@
+/// A token borrowed from the input
+#[derive(Debug)]
+pub enum Token<'a, T: Clone = u8>
+where
+    T: Default,
+{
+    #[default]
+    End,
+    Word(&'a str),
+    Number { value: T, radix: u32 },
+    Other = 4,
+}
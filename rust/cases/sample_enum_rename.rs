@@ -0,0 +1,8 @@
+enum Status {
+    /// All good
+    // rustbuddy(rename = "ok")
+    Success,
+    #[cfg_attr(any(), rustbuddy(rename = "gone"))]
+    NotFound,
+    /* a block comment */ HTTPError(u16),
+}
@@ -0,0 +1,16 @@
+//! Reads the configuration
+#![allow(dead_code)]
+
+#[macro_use]
+extern crate log;
+
+mod defaults;
+pub(crate) use std::collections::HashMap;
+use std::io::{self, Read};
+
+/// The configuration
+pub struct Config {
+    values: HashMap<String, String>,
+}
+
+use std::fmt;
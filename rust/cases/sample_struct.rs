@@ -17,6 +17,7 @@ struct Point {
 
 // Structs can be reused as fields of another struct
 #[allow(dead_code)]
+#[derive(Debug, PartialEq)]
 struct Rectangle {
     p1: Point,
     p2: Point,
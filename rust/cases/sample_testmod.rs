@@ -0,0 +1,30 @@
+use std::fmt;
+
+pub fn add(a: i32, b: i32) -> i32 {
+    a + b
+}
+
+pub(crate) fn sub(a: i32, b: i32) -> i32 {
+    a - b
+}
+
+fn double(a: i32) -> i32 {
+    a * 2
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use std::collections::{HashMap, HashSet};
+
+    fn helper() -> i32 {
+        1
+    }
+
+    #[test]
+    fn test_add() {
+        for (a, b) in vec![(1, 1), (2, 0)] {
+            assert_eq!(add(helper(), a), b + 1 + a - b);
+        }
+    }
+}
@@ -0,0 +1,36 @@
+trait Animal: Named {
+    fn new(name: &'static str) -> Self;
+    fn name(&self) -> &'static str;
+    fn noise(&self) -> &'static str;
+
+    // Traits can provide default method definitions.
+    fn talk(&self) {
+        println!("{} says {}", self.name(), self.noise());
+    }
+}
+
+struct Sheep { naked: bool, name: &'static str }
+
+impl Sheep {
+    fn is_naked(&self) -> bool {
+        self.naked
+    }
+}
+
+impl Animal for Sheep {
+    fn new(name: &'static str) -> Sheep {
+        Sheep { name: name, naked: false }
+    }
+
+    fn name(&self) -> &'static str {
+        self.name
+    }
+
+    fn noise(&self) -> &'static str {
+        if self.is_naked() {
+            "baaaaah?"
+        } else {
+            "baaaaah!"
+        }
+    }
+}
@@ -0,0 +1,4 @@
+fn open() {
+    if true {
+        let c = "}";
+}
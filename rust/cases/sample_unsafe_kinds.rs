@@ -0,0 +1,50 @@
+struct Buffer {
+    ptr: *mut u8,
+    len: usize,
+}
+
+// SAFETY: Buffer owns its allocation exclusively.
+unsafe impl Send for Buffer {}
+
+impl Buffer {
+    fn first(&self) -> u8 {
+        // SAFETY: len is checked before reading.
+        unsafe { *self.ptr }
+    }
+
+    /// # Safety
+    ///
+    /// The index must be less than len.
+    pub unsafe fn get_unchecked(&self, i: usize) -> u8 {
+        *self.ptr.add(i)
+    }
+}
+
+unsafe fn raw_read(p: *const u8) -> u8 {
+    unsafe { *p }
+}
+
+fn main() {
+    let x = 7u8;
+    let y = unsafe {
+        raw_read(&x)
+    };
+}
+
+/// # Safety
+///
+/// All zero bytes must be a valid value.
+pub unsafe trait Zeroable {
+    fn zeroed() -> Self;
+}
+
+// SAFETY: a null pointer and zero length is an empty buffer.
+unsafe impl Zeroable for Buffer {
+    fn zeroed() -> Self {
+        Buffer { ptr: std::ptr::null_mut(), len: 0 }
+    }
+}
+
+unsafe extern "C" {
+    fn abs(x: i32) -> i32;
+}
@@ -2,7 +2,9 @@
 package rust
 
 import (
+	"errors"
 	"os"
+	"strings"
 	"text/scanner"
 )
 
@@ -15,7 +17,14 @@ type Source struct {
 	Traits    []Trait
 	Tests     []Test
 	TestBlock int
+	TestMod   Module
 	UB        []Unsafe
+	Uses      []string // use declarations at the top level of the file
+	// Header is where the inner attributes, inner doc comments, extern
+	// crates, use declarations and out of line modules at the top of the
+	// file end, before its first item. It is the start of the file when
+	// there are none.
+	Header scanner.Position
 }
 
 // Span is the start end end location of a code block
@@ -30,13 +39,24 @@ type Fn struct {
 	Name   string
 	Args   []string
 	Return string
+	Async  bool
+	Public bool
+	Unsafe bool
+	Doc    string
+	Body   string // without the opening brace, empty for declarations
 }
 
-// Enum is an Enumeration of types in rust
+// Enum is an Enumeration of types in rust. Generics are its parameters as
+// declared, ie. <'a, T: Clone>, and Where its where clause. Variants are kept
+// as written, with their attributes.
 type Enum struct {
 	Span     Span
 	Name     string
+	Generics string
+	Where    string
 	Variants []string
+	Derives  []string
+	Public   bool
 }
 
 // RsStruct is a data structure specific to rust source code. The awkward name
@@ -46,13 +66,19 @@ type RsStruct struct {
 	Name    string
 	Methods []Fn
 	Traits  []Trait
+	Derives []string
+	Public  bool
 }
 
-// Trait refers to Rust trait name. Currently, there is no use for the body of
-// a trait definition.
+// Trait refers to Rust trait name. For a trait definition, Methods are the
+// required methods and Defaults are those with a default body. For a trait
+// implemented by an RsStruct, Methods are the methods of the impl block.
 type Trait struct {
-	Span Span
-	Name string
+	Span     Span
+	Name     string
+	Methods  []Fn
+	Defaults []Fn
+	Public   bool
 }
 
 // Test refers to unit tests already within the source
@@ -61,59 +87,266 @@ type Test struct {
 	Span Span
 }
 
-// Unsafe are blocks of code marked unsafe
+// Module is an inline module, such as the tests module. Its span runs from the
+// opening brace to the closing one. Funcs are the functions in the module
+// which are not tests, and Uses its use declarations.
+type Module struct {
+	Span  Span
+	Name  string
+	Uses  []string
+	Funcs []Fn
+}
+
+// Unsafe are blocks of code marked unsafe. Kind is one of "block", "fn",
+// "impl", "trait" or "extern" and Item names the enclosing item, if any.
 type Unsafe struct {
 	Span Span
+	Kind string
+	Item string
 }
 
 // Parse reads rust source code and does a simple lexical analysis
 func Parse(f *os.File) (Source, error) {
 	var s scanner.Scanner
 	var src Source
+	var derives []string // waiting for the struct or enum that follows
+	var docs []string    // waiting for the item that follows
 	s.Init(f)
-	for tok := s.Scan(); tok != scanner.EOF; tok = s.Scan() {
+	balanced := true
+	// lifetimes such as 'a look like unterminated char literals, which are
+	// harmless to the parse
+	s.Error = func(_ *scanner.Scanner, msg string) {
+		if msg == errUnbalanced {
+			balanced = false
+		}
+	}
+	s.Mode ^= scanner.SkipComments // keep comments for the doc comments
+	prev := ""                     // the token before the current one, for modifiers like async
+	public := false
+	depth := 0    // of braces not captured with an item, ie. module bodies
+	testMod := -1 // depth of the body of the tests module while inside it
+	cfgTest := false
+	header := true // while in the header of the file
+	// the position of the unsafe keyword before an item, if any
+	var unsafeAt *scanner.Position
+	asyncUnsafe := false // async came before the unsafe keyword, ie. async unsafe fn
+	for tok := s.Scan(); tok != scanner.EOF; prev, public, tok = s.TokenText(), isPublic(public, s.TokenText()), s.Scan() {
+		if tok == scanner.Comment {
+			if header && isInnerDoc(s.TokenText()) {
+				src.Header = s.Pos()
+			}
+			docs = addDoc(docs, s.TokenText())
+			continue
+		}
+		if header && !isModifier(s.TokenText()) {
+			switch s.TokenText() {
+			case "#", "use", "mod":
+			default:
+				header = false
+			}
+		}
 		switch s.TokenText() {
 		case "!": // macros have completely unpredictable structure, so we need
 			// to zip past them for sanity.
 			collapseMacro(&s)
-		case "#": // attribute
+		case "#": // attribute, unless it is part of a raw string, ie. r#"text"#
 			attName := "#"
-			for {
-				c := s.Next()
-				attName += string(c)
-				if c == ']' {
-					break
-				}
+			if s.Peek() == '!' {
+				attName += string(s.Next())
+			}
+			if s.Peek() != '[' {
+				continue
 			}
+			attName += string(s.Next()) + collapse('[', &s)
 			switch attName {
 			case "#[cfg(test)]":
 				src.TestBlock = s.Pos().Line
-			case "#[test]":
+				cfgTest = true
+				continue
+			case "#[test]", "#[tokio::test]", "#[async_std::test]":
 				t := capTest(&s)
 				src.Tests = append(src.Tests, t)
 			default:
+				if header && strings.HasPrefix(attName, "#![") {
+					src.Header = s.Pos()
+				}
+				if strings.HasPrefix(attName, "#[derive(") {
+					derives = append(derives, parseDerive(attName)...)
+				}
 				continue
 			}
 		// Detect trait and impl first because they can encapsulate other blocks
 		case "trait":
-			src.Traits = append(src.Traits, capTrait(&s))
+			t, ubs := capTrait(&s)
+			t.Public = public
+			if unsafeAt != nil {
+				ub := Unsafe{Span: Span{*unsafeAt, s.Pos()}, Kind: "trait", Item: t.Name}
+				ubs = append([]Unsafe{ub}, ubs...)
+			}
+			src.UB = append(src.UB, ubs...)
+			addTrait(&src, t)
 		case "impl":
-			capImpl(&src, &s)
+			n := len(src.UB)
+			sig := capImpl(&src, &s)
+			if unsafeAt != nil { // before the unsafe blocks of its methods
+				ub := Unsafe{Span: Span{*unsafeAt, s.Pos()}, Kind: "impl", Item: "impl " + sig}
+				src.UB = append(src.UB[:n], append([]Unsafe{ub}, src.UB[n:]...)...)
+			}
 		case "enum":
-			src.Enums = append(src.Enums, capEnum(&s))
+			e := capEnum(&s)
+			e.Public = public
+			e.Derives, derives = derives, nil
+			src.Enums = append(src.Enums, e)
 		case "struct":
-			src.RsStructs = append(src.RsStructs, capStruct(&s))
+			st := capStruct(&s)
+			st.Public = public
+			st.Derives, derives = derives, nil
+			src.RsStructs = append(src.RsStructs, st)
+		case "mod":
+			s.Scan()
+			name := s.TokenText()
+			if s.Scan(); s.TokenText() == "{" {
+				header = false
+				depth++
+				if cfgTest || name == "tests" {
+					testMod = depth
+					src.TestMod = Module{Name: name, Span: Span{Start: s.Position}}
+				}
+			} else if header {
+				src.Header = s.Pos()
+			}
+		case "{":
+			if unsafeAt != nil { // an unsafe extern block
+				collapse('{', &s)
+				src.UB = append(src.UB, Unsafe{Span: Span{*unsafeAt, s.Pos()}, Kind: "extern"})
+				break
+			}
+			depth++
+		case "}":
+			if depth == testMod {
+				src.TestMod.Span.End = s.Position
+				testMod = -1
+			}
+			depth--
+		case "crate":
+			if prev != "extern" { // restricted visibility, ie. pub(crate)
+				continue
+			}
+			advTo(';', &s)
+			if header {
+				src.Header = s.Pos()
+			}
+		case "use":
+			u := capUse(&s)
+			if header {
+				src.Header = s.Pos()
+			}
+			if testMod != -1 {
+				src.TestMod.Uses = append(src.TestMod.Uses, u)
+			} else if depth == 0 {
+				src.Uses = append(src.Uses, u)
+			}
 		case "fn":
 			fn, ubs := capFn(&s)
-			src.Funcs = append(src.Funcs, fn)
+			fn.Async = prev == "async" || unsafeAt != nil && asyncUnsafe
+			fn.Public = public
+			fn.Doc, docs = strings.Join(docs, "\n"), nil
+			if unsafeAt != nil { // the function is recorded as well as its blocks
+				fn.Unsafe = true
+				ub := Unsafe{Span: Span{*unsafeAt, fn.Span.End}, Kind: "fn", Item: fn.Name}
+				ubs = append([]Unsafe{ub}, ubs...)
+			}
+			if testMod != -1 {
+				src.TestMod.Funcs = append(src.TestMod.Funcs, fn)
+			} else {
+				src.Funcs = append(src.Funcs, fn)
+			}
 			if len(ubs) > 0 {
 				src.UB = append(src.UB, ubs...)
 			}
-		case "unsafe":
-			src.UB = append(src.UB, capUB(&s))
+		case "unsafe": // recorded along with the item which follows
+			pos := s.Position
+			unsafeAt, asyncUnsafe = &pos, prev == "async"
+			continue
 		default:
+			if !isModifier(s.TokenText()) {
+				docs = nil
+				unsafeAt = nil
+			}
+			if s.TokenText() == ";" { // the end of an item, ie. const X: u8 = 1;
+				cfgTest = false
+			}
 			continue
 		}
+		// #[cfg(test)] applies to the item just captured and no further
+		docs, cfgTest, unsafeAt = nil, false, nil
+	}
+	if !balanced {
+		return src, errors.New(f.Name() + ": " + errUnbalanced)
 	}
 	return src, nil
 }
+
+// addTrait adds a trait definition, replacing the placeholder left by an impl
+// block which came before the definition.
+func addTrait(src *Source, t Trait) {
+	for i, existing := range src.Traits {
+		if existing.Name == t.Name && existing.Span == (Span{}) {
+			src.Traits[i] = t
+			return
+		}
+	}
+	src.Traits = append(src.Traits, t)
+}
+
+// isPublic updates whether the item being declared is public after tok.
+// Modifiers may come between pub and the item keyword, while restricted
+// visibility such as pub(crate) does not count as public.
+func isPublic(public bool, tok string) bool {
+	switch tok {
+	case "pub":
+		return true
+	case "async", "const", "unsafe", "extern":
+		return public
+	}
+	return public && strings.HasPrefix(tok, `"`) // extern "C"
+}
+
+// isModifier reports whether tok may come between the doc comment of an item
+// and the keyword which starts it, ie. pub(crate) async
+func isModifier(tok string) bool {
+	switch tok {
+	case "pub", "(", "crate", "super", "self", "in", ")", "async", "const", "unsafe", "extern":
+		return true
+	}
+	return strings.HasPrefix(tok, `"`)
+}
+
+// addDoc adds the text of an outer doc comment, ie. /// Text, to docs. Other
+// comments are ignored.
+func addDoc(docs []string, comment string) []string {
+	if !strings.HasPrefix(comment, "///") || strings.HasPrefix(comment, "////") {
+		return docs
+	}
+	text := strings.TrimPrefix(comment, "///")
+	return append(docs, strings.TrimPrefix(text, " "))
+}
+
+// isInnerDoc reports whether a comment documents the enclosing module, ie.
+// //! Text
+func isInnerDoc(comment string) bool {
+	return strings.HasPrefix(comment, "//!") || strings.HasPrefix(comment, "/*!")
+}
+
+// parseDerive lists the traits in a derive attribute, ie. #[derive(Debug)]
+func parseDerive(att string) []string {
+	var traits []string
+	att = strings.TrimPrefix(att, "#[derive(")
+	att = strings.TrimSuffix(att, ")]")
+	for _, t := range strings.Split(att, ",") {
+		if t = strings.TrimSpace(t); t != "" {
+			traits = append(traits, t)
+		}
+	}
+	return traits
+}
@@ -10,21 +10,40 @@ import (
 // capture a function body
 func capFn(s *scanner.Scanner) (Fn, []Unsafe) {
 	var UBs []Unsafe
+	f, fnBody, bodyStart := capFnBody(s)
+	f.Body = fnBody
+	// Go back through the function body to check for `unsafe`. This really
+	// should be refactored completely to find these blocks in the first pass.
+	if len(fnBody) > 0 {
+		UBs = scanUB(fnBody, bodyStart, f.Name)
+	}
+	return f, UBs
+}
+
+// capture a function signature along with the text of the body and where it
+// begins. Declarations without a body return an empty string.
+func capFnBody(s *scanner.Scanner) (Fn, string, scanner.Position) {
 	var fnBody string
 	var fnSig string
 	var sp Span
+	var bodyStart scanner.Position
 	sp.Start = s.Pos()
 	for {
 		c := s.Next()
+		if c == scanner.EOF {
+			unbalanced(s)
+			break
+		}
 		if c == ';' { // This is a function without a body.
 			break
 		}
 		if c == '{' {
+			bodyStart = s.Pos()
 			fnBody = collapse(c, s)
 			break
 		}
 		if c == '<' {
-			collapse(c, s)
+			fnSig += string(c) + collapse(c, s)
 			continue
 		}
 		fnSig += string(c)
@@ -33,42 +52,74 @@ func capFn(s *scanner.Scanner) (Fn, []Unsafe) {
 	f := parseFnSig(fnSig)
 	sp.End = s.Pos()
 	f.Span = sp
-	// Go back through the function body to check for `unsafe`. This really
-	// should be refactored completely to find these blocks in the first pass.
-	if len(fnBody) > 0 {
-		fnBody += string(scanner.EOF) // yes, this is actually necessary
-		var ubscan scanner.Scanner
-		ubscan.Init(strings.NewReader(fnBody))
-		for tok := ubscan.Scan(); tok != scanner.EOF; tok = ubscan.Scan() {
-			if ubscan.TokenText() == "unsafe" {
-				UBs = append(UBs, capUB(&ubscan))
+	return f, fnBody, bodyStart
+}
+
+// scanUB finds unsafe blocks within a function body. Positions are reported
+// relative to the start of the body, so they are shifted back to be relative
+// to the start of the file.
+func scanUB(body string, base scanner.Position, item string) []Unsafe {
+	var UBs []Unsafe
+	body += string(scanner.EOF) // yes, this is actually necessary
+	var ubscan scanner.Scanner
+	ubscan.Init(strings.NewReader(body))
+	ubscan.Error = func(*scanner.Scanner, string) {}
+	for tok := ubscan.Scan(); tok != scanner.EOF; tok = ubscan.Scan() {
+		if ubscan.TokenText() == "unsafe" {
+			ub, nested := capUB(&ubscan)
+			for _, u := range append([]Unsafe{ub}, nested...) {
+				u.Span.Start = shift(u.Span.Start, base)
+				u.Span.End = shift(u.Span.End, base)
+				if u.Item == "" {
+					u.Item = item
+				}
+				UBs = append(UBs, u)
 			}
 		}
 	}
-	return f, UBs
+	return UBs
 }
 
 // parseFn extracts the meaningful components from a function signature string.
+// Generic parameters are dropped from the name, but types are kept whole.
 func parseFnSig(s string) Fn {
-	argBegin := strings.Index(s, "(")
-	argEnd := strings.LastIndex(s, ")")
-	retBegin := strings.LastIndex(s, "->")
-	r := ""
-	if retBegin != -1 {
-		//argEnd will get tripped up by a unit return "()" we fix it here
-		argEnd = strings.LastIndex(s[:retBegin], ")")
-		r = s[retBegin+3:]
+	argBegin := indexTop(s, '(')
+	if argBegin == -1 {
+		return Fn{Name: strings.TrimSpace(s), Args: []string{}}
+	}
+	argEnd := closeParen(s, argBegin)
+	name := s[:argBegin]
+	if i := strings.Index(name, "<"); i != -1 {
+		name = name[:i]
+	}
+	args := []string{}
+	for _, a := range SplitTop(s[argBegin+1:argEnd], ',') {
+		a = strings.TrimSpace(a)
+		if a != "" {
+			args = append(args, a)
+		}
+	}
+	r := strings.TrimSpace(s[argEnd+1:])
+	if strings.HasPrefix(r, "->") {
+		r = strings.TrimSpace(r[2:])
+		if i := indexWhere(r); i != -1 {
+			r = strings.TrimSpace(r[:i])
+		}
+	} else {
+		r = ""
 	}
 	return Fn{
 		Span:   Span{},
-		Name:   s[0:argBegin],
-		Args:   strings.Split(s[argBegin+1:argEnd], ","),
+		Name:   strings.TrimSpace(name),
+		Args:   args,
 		Return: r,
 	}
 }
 
-// capture a trait definition body, ignoring child functions
-func capTrait(s *scanner.Scanner) Trait {
+// capture a trait definition. Methods without a body are required of the
+// implementing type and the rest are kept as default methods.
+func capTrait(s *scanner.Scanner) (Trait, []Unsafe) {
+	var UBs []Unsafe
 	t := ""
 	start := s.Pos()
 	for {
@@ -77,22 +128,55 @@ func capTrait(s *scanner.Scanner) Trait {
 			collapse(c, s)
 			continue
 		}
-		if c == '{' || c == '(' {
-			collapse(c, s)
+		if c == '{' || c == ';' || c == scanner.EOF {
 			break
 		}
 		t += string(c)
 	}
-	end := s.Pos()
-	spn := Span{
-		Start: start,
-		End:   end,
+	// drop any supertraits and where clauses
+	t = strings.TrimSpace(strings.SplitN(t, ":", 2)[0])
+	if fields := strings.Fields(t); len(fields) > 0 {
+		t = fields[0]
 	}
-	t = strings.TrimSpace(t)
-	return Trait{
-		Name: t,
-		Span: spn,
+	trait := Trait{
+		Name:     t,
+		Methods:  []Fn{},
+		Defaults: []Fn{},
+	}
+	prev := ""
+	unsafeFn := false    // whether the method being declared is unsafe
+	asyncUnsafe := false // async came before the unsafe keyword
+	for tok := s.Scan(); tok != scanner.EOF; prev, tok = s.TokenText(), s.Scan() {
+		if s.TokenText() == "unsafe" {
+			unsafeFn, asyncUnsafe = true, prev == "async"
+		} else if s.TokenText() != "fn" && !isModifier(s.TokenText()) {
+			unsafeFn = false
+		}
+		switch s.TokenText() {
+		case "fn":
+			f, body, bodyStart := capFnBody(s)
+			f.Body = body
+			f.Async = prev == "async" || unsafeFn && asyncUnsafe
+			f.Unsafe, unsafeFn = unsafeFn, false
+			if len(body) == 0 {
+				trait.Methods = append(trait.Methods, f)
+				continue
+			}
+			trait.Defaults = append(trait.Defaults, f)
+			for _, u := range scanUB(body, bodyStart, f.Name) {
+				u.Item = t + "::" + u.Item
+				UBs = append(UBs, u)
+			}
+		case "}":
+			goto stopCapture
+		}
 	}
+stopCapture:
+	trait.Span = Span{
+		Start: start,
+		End:   s.Pos(),
+	}
+	return trait, UBs
 }
 
 // Capture a test block, ignoring everything but the function name
@@ -101,6 +185,10 @@ func capTest(s *scanner.Scanner) Test {
 	name := ""
 	for {
 		c := s.Next()
+		if c == scanner.EOF {
+			unbalanced(s)
+			break
+		}
 		if c == '(' {
 			c = advTo('{', s)
 			collapse(c, s)
@@ -108,7 +196,9 @@ func capTest(s *scanner.Scanner) Test {
 		}
 		name += string(c)
 	}
-	name = strings.Split(name, "fn ")[1]
+	if parts := strings.Split(name, "fn "); len(parts) > 1 {
+		name = parts[1]
+	}
 	end := s.Pos()
 	spn := Span{
 		Start: start,
@@ -126,6 +216,10 @@ func capStruct(s *scanner.Scanner) RsStruct {
 	name := ""
 	for {
 		c := s.Next()
+		if c == scanner.EOF {
+			unbalanced(s)
+			break
+		}
 		if c == ';' {
 			break
 		}
@@ -161,18 +255,27 @@ func capEnum(s *scanner.Scanner) Enum {
 	depth := 0
 	for {
 		c := s.Next()
+		if c == scanner.EOF {
+			unbalanced(s)
+			break
+		}
 		if c == '{' {
 			depth++
 			break
 		}
 		name += string(c)
 	}
-	name = strings.TrimSpace(name)
+	name, generics, where := splitGenerics(name)
 	endEnum := false
 	for {
 		variant := ""
 		for {
 			c := s.Next()
+			if c == scanner.EOF {
+				unbalanced(s)
+				endEnum = true
+				break
+			}
 			if c == ',' {
 				break
 			}
@@ -181,12 +284,18 @@ func capEnum(s *scanner.Scanner) Enum {
 				variant += collapse(c, s)
 				break
 			}
+			if c == '[' { // attribute of the variant
+				variant += string(c) + collapse(c, s)
+				continue
+			}
 			if c == '}' {
 				endEnum = true
 				break
 			}
 			if c == '/' {
-				advTo('\n', s)
+				if comment := capComment(s); strings.Contains(comment, "rustbuddy(") {
+					variant += comment + "\n" // attributes for rustbuddy
+				}
 				continue
 			}
 			variant += string(c)
@@ -208,14 +317,57 @@ func capEnum(s *scanner.Scanner) Enum {
 	return Enum{
 		Span:     spn,
 		Name:     name,
+		Generics: generics,
+		Where:    where,
 		Variants: vars,
 	}
 
 }
 
+// capComment captures a comment after its opening slash. Line comments end
+// before the newline.
+func capComment(s *scanner.Scanner) string {
+	comment := "/"
+	switch s.Next() {
+	case '/':
+		comment += "/"
+		for s.Peek() != '\n' && s.Peek() != scanner.EOF {
+			comment += string(s.Next())
+		}
+	case '*':
+		comment += "*"
+		for prev := ' '; ; {
+			c := s.Next()
+			if c == scanner.EOF {
+				break
+			}
+			comment += string(c)
+			if prev == '*' && c == '/' {
+				break
+			}
+			prev = c
+		}
+	}
+	return comment
+}
+
+// splitGenerics separates the header of an item, ie. Foo<'a, T> where T: Eq,
+// into its name, generic parameters and where clause
+func splitGenerics(header string) (string, string, string) {
+	header = strings.TrimSpace(header)
+	name, generics, where := header, "", ""
+	if i := indexTop(header, '<'); i != -1 {
+		j := closeParen(header, i)
+		name, generics, where = header[:i], header[i:j+1], header[j+1:]
+	}
+	where = strings.TrimSuffix(strings.Join(strings.Fields(where), " "), ",")
+	return strings.TrimSpace(name), generics, where
+}
+
 // impl signatures can be highly varied. One-pass procedural handling does not
-// seem to have an obvious, practical implementation.
-func capImpl(src *Source, s *scanner.Scanner) {
+// seem to have an obvious, practical implementation. The signature is
+// returned without its generics, ie. Send for Buffer.
+func capImpl(src *Source, s *scanner.Scanner) string {
 	var (
 		sig        string
 		traitName  string
@@ -223,6 +375,10 @@ func capImpl(src *Source, s *scanner.Scanner) {
 	)
 	for {
 		c := s.Next()
+		if c == scanner.EOF {
+			unbalanced(s)
+			return ""
+		}
 		if c == '<' || c == '(' {
 			collapse(c, s)
 			continue
@@ -235,7 +391,7 @@ func capImpl(src *Source, s *scanner.Scanner) {
 	if strings.Contains(sig, " for ") {
 		parts := strings.Split(sig, " for ")
 		i := strings.LastIndex(parts[0], " ")
-		traitName = parts[0][i:]
+		traitName = strings.TrimSpace(parts[0][i:])
 		j := strings.IndexRune(parts[1], '<')
 		if j == -1 {
 			j = strings.IndexAny(parts[1], " \n")
@@ -283,32 +439,136 @@ func capImpl(src *Source, s *scanner.Scanner) {
 		src.RsStructs = append(src.RsStructs, newStruct)
 		m = len(src.RsStructs) - 1
 	}
-	// capture all child functions and append to methods array
-
-	for tok := s.Scan(); tok != scanner.EOF; tok = s.Scan() {
+	// capture all child functions and append to methods array. Methods of
+	// trait implementations are kept with the trait.
+	methods := &src.RsStructs[m].Methods
+	if traitName != "" {
+		impl := Trait{
+			Name:    traitName,
+			Span:    Span{},
+			Methods: []Fn{},
+		}
+		src.RsStructs[m].Traits = append(src.RsStructs[m].Traits, impl)
+		methods = &src.RsStructs[m].Traits[len(src.RsStructs[m].Traits)-1].Methods
+	}
+	prev := ""
+	public := false
+	var docs []string
+	// the position of the unsafe keyword before a method, if any
+	var unsafeAt *scanner.Position
+	asyncUnsafe := false // async came before the unsafe keyword
+	for tok := s.Scan(); tok != scanner.EOF; prev, public, tok = s.TokenText(), isPublic(public, s.TokenText()), s.Scan() {
+		if tok == scanner.Comment {
+			docs = addDoc(docs, s.TokenText())
+			continue
+		}
+		if s.TokenText() == "#" { // an attribute, which may follow the docs
+			advTo(']', s)
+			continue
+		}
+		if s.TokenText() != "fn" && !isModifier(s.TokenText()) {
+			docs = nil
+			unsafeAt = nil
+		}
 		switch s.TokenText() {
 		case "fn":
 			f, ubs := capFn(s)
-			src.RsStructs[m].Methods = append(src.RsStructs[m].Methods, f)
-			if len(ubs) > 0 {
-				src.UB = append(src.UB, ubs...)
+			f.Async = prev == "async" || unsafeAt != nil && asyncUnsafe
+			f.Public = public
+			f.Doc, docs = strings.Join(docs, "\n"), nil
+			if unsafeAt != nil { // the method is recorded as well as its blocks
+				f.Unsafe = true
+				ub := Unsafe{Span: Span{*unsafeAt, f.Span.End}, Kind: "fn", Item: f.Name}
+				ubs = append([]Unsafe{ub}, ubs...)
+				unsafeAt = nil
 			}
+			*methods = append(*methods, f)
+			for _, u := range ubs {
+				u.Item = structName + "::" + u.Item
+				src.UB = append(src.UB, u)
+			}
+		case "unsafe":
+			pos := s.Position
+			unsafeAt, asyncUnsafe = &pos, prev == "async"
 		case "}":
 			goto stopCapture // There should be no nested brackets outside of functions
 		}
 	}
 stopCapture:
+	return strings.Join(strings.Fields(sig), " ")
+}
+
+// capture a use declaration, ie. use std::fmt;
+func capUse(s *scanner.Scanner) string {
+	decl := "use"
+	for {
+		c := s.Next()
+		if c == scanner.EOF {
+			break
+		}
+		decl += string(c)
+		if c == ';' {
+			break
+		}
+	}
+	return strings.Join(strings.Fields(decl), " ")
 }
 
-func capUB(s *scanner.Scanner) Unsafe {
+// capture the item or block following an unsafe keyword. Unsafe functions
+// are scanned for nested unsafe blocks, which are returned separately.
+func capUB(s *scanner.Scanner) (Unsafe, []Unsafe) {
 	var sp Span
-	advTo('{', s)
-	sp.Start = s.Pos()
-	collapse('{', s)
+	var nested []Unsafe
+	var bodyStart scanner.Position
+	body := ""
+	header := ""
+	sp.Start = s.Position
+	for {
+		c := s.Next()
+		if c == ';' || c == scanner.EOF { // a declaration without a body
+			break
+		}
+		if c == '{' {
+			bodyStart = s.Pos()
+			body = collapse(c, s)
+			break
+		}
+		if c == '<' || c == '(' {
+			collapse(c, s)
+			continue
+		}
+		header += string(c)
+	}
 	sp.End = s.Pos()
-	return Unsafe{Span: sp}
+	ub := Unsafe{Span: sp, Kind: "block"}
+	fields := strings.Fields(header)
+	for i, word := range fields {
+		switch word {
+		case "fn", "trait":
+			ub.Kind = word
+			if i+1 < len(fields) {
+				ub.Item = fields[i+1]
+			}
+		case "impl":
+			ub.Kind = word
+			ub.Item = strings.Join(fields, " ")
+		case "extern":
+			ub.Kind = word
+			continue
+		default:
+			continue
+		}
+		break
+	}
+	if ub.Kind == "fn" && len(body) > 0 {
+		nested = scanUB(body, bodyStart, ub.Item)
+	}
+	return ub, nested
 }
 
+// collapse captures everything up to the bracket closing current. Brackets
+// within string and char literals or comments are not counted. A missing
+// bracket is reported through the error function of the scanner.
 func collapse(current rune, s *scanner.Scanner) string {
 	var content string
 	left := current
@@ -318,11 +578,31 @@ func collapse(current rune, s *scanner.Scanner) string {
 		right = ')'
 	case '<':
 		right = '>'
+	case '[':
+		right = ']'
 	default:
 	}
 	open := 1
 	for {
 		c := s.Next()
+		if c == scanner.EOF {
+			unbalanced(s)
+			break
+		}
+		switch {
+		case c == '"':
+			content += string(c) + capString(s, "")
+			continue
+		case c == 'r' && (s.Peek() == '"' || s.Peek() == '#'):
+			content += string(c) + capRawString(s)
+			continue
+		case c == '\'':
+			content += string(c) + capChar(s)
+			continue
+		case c == '/' && (s.Peek() == '/' || s.Peek() == '*'):
+			content += capComment(s)
+			continue
+		}
 		content += string(c)
 		if c == right {
 			open--
@@ -337,6 +617,77 @@ func collapse(current rune, s *scanner.Scanner) string {
 	return content
 }
 
+// capString captures the rest of a string literal after its opening quote
+// and any hashes of a raw string, which are given as closing
+func capString(s *scanner.Scanner, closing string) string {
+	var content string
+	for {
+		c := s.Next()
+		if c == scanner.EOF {
+			unbalanced(s)
+			return content
+		}
+		content += string(c)
+		if c == '\\' && closing == "" {
+			content += string(s.Next())
+			continue
+		}
+		if c == '"' {
+			hashes := ""
+			for len(hashes) < len(closing) && s.Peek() == '#' {
+				hashes += string(s.Next())
+			}
+			content += hashes
+			if hashes == closing {
+				return content
+			}
+		}
+	}
+}
+
+// capRawString captures a raw string after its r, ie. #"text"#. A raw
+// identifier such as r#type is captured up to the hash.
+func capRawString(s *scanner.Scanner) string {
+	hashes := ""
+	for s.Peek() == '#' {
+		hashes += string(s.Next())
+	}
+	if s.Peek() != '"' {
+		return hashes
+	}
+	return hashes + string(s.Next()) + capString(s, hashes)
+}
+
+// capChar captures the rest of a char literal after its opening quote. For
+// a lifetime, ie. 'a, only its first letter is captured.
+func capChar(s *scanner.Scanner) string {
+	c := s.Next()
+	if c == scanner.EOF {
+		return ""
+	}
+	content := string(c)
+	if c == '\\' {
+		for c = s.Next(); c != '\'' && c != scanner.EOF; c = s.Next() {
+			content += string(c)
+		}
+		return content + string(c)
+	}
+	if s.Peek() == '\'' {
+		content += string(s.Next())
+	}
+	return content
+}
+
+// errUnbalanced is reported when the source ends before a bracket is closed
+const errUnbalanced = "unbalanced brackets"
+
+// unbalanced reports a bracket which is never closed
+func unbalanced(s *scanner.Scanner) {
+	if s.Error != nil {
+		s.Error(s, errUnbalanced)
+	}
+}
+
 // Call from exclamation point. Will peek and then advance to first opening block
 // which may be ( or {, then calls collapse.
 func collapseMacro(s *scanner.Scanner) {
@@ -364,10 +715,32 @@ cmTop:
 func advTo(target rune, s *scanner.Scanner) rune {
 	var c rune
 	for {
-		c := s.Next()
-		if c == target {
+		c = s.Next()
+		if c == target || c == scanner.EOF {
 			break
 		}
 	}
 	return c
 }
+
+// shift moves a position found within a substring so that it is relative to
+// base, the position where the substring begins.
+func shift(p, base scanner.Position) scanner.Position {
+	if p.Line == 1 {
+		p.Column += base.Column - 1
+	}
+	p.Line += base.Line - 1
+	p.Offset += base.Offset
+	p.Filename = base.Filename
+	return p
+}
+
+// indexWhere finds the start of a where clause
+func indexWhere(s string) int {
+	for _, sep := range []string{" where", "\nwhere", "\twhere"} {
+		if i := strings.Index(s, sep); i != -1 {
+			return i
+		}
+	}
+	return -1
+}
@@ -46,6 +46,9 @@ func TestStruct(t *testing.T) {
 		got := strings.Join(found, "|")
 		t.Errorf("Invalid struct parse. Values are the following:\n%s", got)
 	}
+	if len(src.RsStructs) == 5 && !cmpall(src.RsStructs[4].Derives, []string{"Debug", "PartialEq"}) {
+		t.Errorf("Invalid struct parse. Derives are the following:\n%v", src.RsStructs[4].Derives)
+	}
 }
 
 func TestUnsafe(t *testing.T) {
@@ -58,6 +61,110 @@ func TestUnsafe(t *testing.T) {
 	}
 }
 
+func TestUnsafeKinds(t *testing.T) {
+	f, _ := os.Open("cases/sample_unsafe_kinds.rs")
+	expected := []Unsafe{
+		{Kind: "impl", Item: "impl Send for Buffer"},
+		{Kind: "block", Item: "Buffer::first"},
+		{Kind: "fn", Item: "Buffer::get_unchecked"},
+		{Kind: "fn", Item: "raw_read"},
+		{Kind: "block", Item: "raw_read"},
+		{Kind: "block", Item: "main"},
+		{Kind: "trait", Item: "Zeroable"},
+		{Kind: "impl", Item: "impl Zeroable for Buffer"},
+		{Kind: "extern", Item: ""},
+	}
+	expectedLines := []int{7, 12, 18, 23, 24, 29, 37, 42, 48}
+	src, _ := Parse(f)
+	if len(src.UB) != len(expected) {
+		t.Fatalf("Expected %d unsafe items. Found %d: %v", len(expected), len(src.UB), src.UB)
+	}
+	for i, u := range src.UB {
+		if u.Kind != expected[i].Kind || u.Item != expected[i].Item {
+			t.Errorf("Invalid unsafe parse.\nexpected: %s %s\tgot: %s %s", expected[i].Kind, expected[i].Item, u.Kind, u.Item)
+		}
+		if u.Span.Start.Line != expectedLines[i] {
+			t.Errorf("Invalid unsafe position for %s.\nexpected line: %d\tgot: %d", u.Item, expectedLines[i], u.Span.Start.Line)
+		}
+	}
+	var methods []string
+	for _, s := range src.RsStructs {
+		if s.Name != "Buffer" {
+			continue
+		}
+		for _, m := range s.Methods {
+			methods = append(methods, m.Name)
+			if m.Name == "get_unchecked" && (!m.Public || !m.Unsafe || !strings.Contains(m.Doc, "# Safety")) {
+				t.Errorf("Invalid unsafe method parse: %+v", m)
+			}
+			if m.Name == "first" && m.Unsafe {
+				t.Errorf("Invalid unsafe method parse: %+v", m)
+			}
+		}
+	}
+	if strings.Join(methods, " ") != "first get_unchecked" {
+		t.Errorf("Expected methods first and get_unchecked. Found %v", methods)
+	}
+	// unsafe traits and impls are parsed like any other
+	var impls []string
+	for _, s := range src.RsStructs {
+		for _, t := range s.Traits {
+			if len(t.Methods) > 0 {
+				impls = append(impls, s.Name+" "+t.Name+" "+t.Methods[0].Name)
+			}
+		}
+	}
+	if strings.Join(impls, ",") != "Buffer Zeroable zeroed" {
+		t.Errorf("Expected Zeroable::zeroed implemented for Buffer. Found %v", impls)
+	}
+	var traits []string
+	for _, t := range src.Traits {
+		if t.Name == "Zeroable" && t.Public && len(t.Methods) == 1 {
+			traits = append(traits, t.Name)
+		}
+	}
+	if len(traits) != 1 {
+		t.Errorf("Expected the public trait Zeroable with one method. Found %+v", src.Traits)
+	}
+	// unsafe functions are parsed like any other and marked as unsafe
+	if len(src.Funcs) != 2 || src.Funcs[0].Name != "raw_read" || !src.Funcs[0].Unsafe || src.Funcs[1].Unsafe {
+		t.Errorf("Expected the unsafe raw_read and main among the functions. Found %v", src.Funcs)
+	}
+}
+
+func TestBraceLiterals(t *testing.T) {
+	f, _ := os.Open("cases/sample_brace.rs")
+	src, err := Parse(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, f := range src.Funcs {
+		names = append(names, f.Name)
+	}
+	if strings.Join(names, " ") != "open label first" {
+		t.Errorf("Expected functions open, label and first. Found %v", names)
+	}
+	if len(src.UB) != 1 || src.UB[0].Item != "first" || src.UB[0].Span.End.Line != 18 {
+		t.Errorf("Invalid unsafe parse: %v", src.UB)
+	}
+}
+
+func TestUnbalanced(t *testing.T) {
+	f, _ := os.Open("cases/sample_unbalanced.rs")
+	if _, err := Parse(f); err == nil {
+		t.Error("Expected an error for an unclosed brace")
+	}
+}
+
+func TestCfgTestItems(t *testing.T) {
+	f, _ := os.Open("cases/sample_cfgtest.rs")
+	src, _ := Parse(f)
+	if src.TestMod.Name != "" {
+		t.Errorf("Expected no tests module. Found: %v", src.TestMod)
+	}
+}
+
 func TestFn(t *testing.T) {
 	f, _ := os.Open("cases/sample_fn.rs")
 	expectedNames := []string{
@@ -88,6 +195,40 @@ func TestFn(t *testing.T) {
 	fmt.Println("last line")
 }
 
+func TestFnSig(t *testing.T) {
+	cases := []struct {
+		sig  string
+		want Fn
+	}{
+		{"add(a: i32, b: i32) -> i32", Fn{Name: "add", Args: []string{"a: i32", "b: i32"}, Return: "i32"}},
+		{"none()", Fn{Name: "none", Args: []string{}, Return: ""}},
+		{"push(&mut self, m: HashMap<K, V>)", Fn{Name: "push", Args: []string{"&mut self", "m: HashMap<K, V>"}, Return: ""}},
+		{"shared(self: Rc<Self>) -> Option<u8>", Fn{Name: "shared", Args: []string{"self: Rc<Self>"}, Return: "Option<u8>"}},
+		{"apply<F: Fn(u8) -> u8>(f: F) -> Result<(), String> where F: Copy", Fn{Name: "apply", Args: []string{"f: F"}, Return: "Result<(), String>"}},
+		{"boxed(x: u8) -> Box<dyn Fn() -> u8>", Fn{Name: "boxed", Args: []string{"x: u8"}, Return: "Box<dyn Fn() -> u8>"}},
+	}
+	for _, c := range cases {
+		got := parseFnSig(c.sig)
+		if got.Name != c.want.Name || got.Return != c.want.Return || !cmpall(got.Args, c.want.Args) {
+			t.Errorf("Invalid signature parse of %s.\nexpected: %q %q %q\tgot: %q %q %q", c.sig, c.want.Name, c.want.Args, c.want.Return, got.Name, got.Args, got.Return)
+		}
+	}
+}
+
+func TestAsync(t *testing.T) {
+	f, _ := os.Open("cases/sample_async.rs")
+	src, _ := Parse(f)
+	if len(src.Funcs) != 2 || !src.Funcs[0].Async || src.Funcs[1].Async {
+		t.Errorf("Invalid async parse. Functions are the following:\n%v", src.Funcs)
+	}
+	if src.Funcs[0].Name != "fetch" {
+		t.Errorf("Invalid async parse. Name should be fetch, got: %s", src.Funcs[0].Name)
+	}
+	if len(src.RsStructs) != 1 || len(src.RsStructs[0].Methods) != 1 || !src.RsStructs[0].Methods[0].Async {
+		t.Errorf("Invalid async parse. Methods are the following:\n%v", src.RsStructs)
+	}
+}
+
 func TestImpl(t *testing.T) {
 	f, _ := os.Open("cases/sample_impl.rs")
 	exMap := make(map[string][]string)
@@ -113,6 +254,34 @@ func TestImpl(t *testing.T) {
 
 }
 
+func TestTrait(t *testing.T) {
+	f, _ := os.Open("cases/sample_trait.rs")
+	src, _ := Parse(f)
+	if len(src.Traits) != 1 || src.Traits[0].Name != "Animal" {
+		t.Fatalf("Invalid trait parse. Found: %v", src.Traits)
+	}
+	required := []string{}
+	for _, m := range src.Traits[0].Methods {
+		required = append(required, m.Name)
+	}
+	if cmpall(required, []string{"new", "name", "noise"}) != true {
+		t.Errorf("Invalid trait parse. Required methods are the following:\n%v", required)
+	}
+	if len(src.Traits[0].Defaults) != 1 || src.Traits[0].Defaults[0].Name != "talk" {
+		t.Errorf("Invalid trait parse. Default methods are the following:\n%v", src.Traits[0].Defaults)
+	}
+	if len(src.RsStructs) != 1 {
+		t.Fatalf("Invalid impl parse. Found: %v", src.RsStructs)
+	}
+	sheep := src.RsStructs[0]
+	if len(sheep.Methods) != 1 || sheep.Methods[0].Name != "is_naked" {
+		t.Errorf("Invalid impl parse. Inherent methods are the following:\n%v", sheep.Methods)
+	}
+	if len(sheep.Traits) != 1 || sheep.Traits[0].Name != "Animal" || len(sheep.Traits[0].Methods) != 3 {
+		t.Errorf("Invalid impl parse. Trait impls are the following:\n%v", sheep.Traits)
+	}
+}
+
 func cmpall(a, b []string) bool {
 	if len(a) != len(b) {
 		return false
@@ -139,3 +308,126 @@ func contains(a []string, b string) bool {
 	}
 	return false
 }
+
+func TestTestMod(t *testing.T) {
+	f, _ := os.Open("cases/sample_testmod.rs")
+	src, _ := Parse(f)
+	if len(src.Funcs) != 3 {
+		t.Fatalf("Invalid parse. Functions are the following:\n%v", src.Funcs)
+	}
+	if !src.Funcs[0].Public || src.Funcs[1].Public || src.Funcs[2].Public {
+		t.Errorf("Invalid visibility parse. Functions are the following:\n%v", src.Funcs)
+	}
+	mod := src.TestMod
+	if mod.Name != "tests" || mod.Span.Start.Line != 16 || mod.Span.End.Line != 30 {
+		t.Errorf("Invalid tests module parse. Found: %v", mod)
+	}
+	uses := []string{"use super::*;", "use std::collections::{HashMap, HashSet};"}
+	if cmpall(mod.Uses, uses) != true {
+		t.Errorf("Invalid use parse. Expected %q, found %q", uses, mod.Uses)
+	}
+	if cmpall(src.Uses, []string{"use std::fmt;"}) != true {
+		t.Errorf("Invalid use parse. Expected only use std::fmt; at the top level, found %q", src.Uses)
+	}
+	if len(mod.Funcs) != 1 || mod.Funcs[0].Name != "helper" {
+		t.Errorf("Invalid tests module parse. Functions are the following:\n%v", mod.Funcs)
+	}
+	if len(src.Tests) != 1 || src.Tests[0].Name != "test_add" {
+		t.Errorf("Invalid test parse. Found: %v", src.Tests)
+	}
+}
+
+func TestDoc(t *testing.T) {
+	f, _ := os.Open("cases/sample_doc.rs")
+	src, _ := Parse(f)
+	docs := map[string]string{
+		"add":   "Adds two numbers.\n\n# Examples\n\n```\nassert_eq!(add(1, 2), 3);\n```",
+		"plain": "",
+		"mul":   "Multiplies two numbers.",
+	}
+	if len(src.Funcs) != 3 {
+		t.Fatalf("Invalid parse. Functions are the following:\n%v", src.Funcs)
+	}
+	for _, fn := range src.Funcs {
+		if fn.Doc != docs[fn.Name] {
+			t.Errorf("Invalid doc parse of %s. Expected %q, got %q", fn.Name, docs[fn.Name], fn.Doc)
+		}
+	}
+	if len(src.RsStructs) != 1 || len(src.RsStructs[0].Methods) != 2 {
+		t.Fatalf("Invalid impl parse. Found: %v", src.RsStructs)
+	}
+	methods := src.RsStructs[0].Methods
+	if methods[0].Doc != "Counts one more." || methods[1].Doc != "" {
+		t.Errorf("Invalid doc parse of methods. Found %q and %q", methods[0].Doc, methods[1].Doc)
+	}
+	if !methods[0].Public || methods[1].Public {
+		t.Errorf("Invalid visibility parse of methods. Found: %v", methods)
+	}
+}
+
+func TestHeader(t *testing.T) {
+	f, _ := os.Open("cases/sample_header.rs")
+	src, _ := Parse(f)
+	if src.Header.Line != 9 || src.Header.Column != 27 {
+		t.Errorf("Invalid header parse. Expected the end of line 9, found %v", src.Header)
+	}
+	f, _ = os.Open("cases/sample_doc.rs")
+	src, _ = Parse(f)
+	if src.Header.Line != 1 {
+		t.Errorf("Invalid header parse. Expected the crate docs, found %v", src.Header)
+	}
+	f, _ = os.Open("cases/sample_fn.rs")
+	src, _ = Parse(f)
+	if src.Header.Offset != 0 {
+		t.Errorf("Invalid header parse. Expected none, found %v", src.Header)
+	}
+}
+
+func TestEnumGeneric(t *testing.T) {
+	f, _ := os.Open("cases/sample_enum_generic.rs")
+	src, _ := Parse(f)
+	if len(src.Enums) != 1 {
+		t.Fatalf("Invalid Enum parse. Found: %v", src.Enums)
+	}
+	e := src.Enums[0]
+	if e.Name != "Token" || e.Generics != "<'a, T: Clone = u8>" || e.Where != "where T: Default" {
+		t.Errorf("Invalid Enum header parse. Found %q, %q and %q", e.Name, e.Generics, e.Where)
+	}
+	if GenericParams(e.Generics) != "<'a, T: Clone>" || GenericArgs(e.Generics) != "<'a, T>" {
+		t.Errorf("Invalid generics. Found %q and %q", GenericParams(e.Generics), GenericArgs(e.Generics))
+	}
+	patterns := []string{"End", "Word(..)", "Number { .. }", "Other"}
+	if len(e.Variants) != len(patterns) {
+		t.Fatalf("Invalid Enum parse. Variants are the following:\n%q", e.Variants)
+	}
+	for i, v := range e.Variants {
+		if VariantPattern(v) != patterns[i] {
+			t.Errorf("Invalid pattern of %q. Expected %q, got %q", v, patterns[i], VariantPattern(v))
+		}
+	}
+	if attrs := VariantAttributes(e.Variants[0]); len(attrs) != 1 || attrs[0] != "#[default]" {
+		t.Errorf("Invalid variant attributes. Found %q", attrs)
+	}
+}
+
+func TestEnumAttributes(t *testing.T) {
+	f, _ := os.Open("cases/sample_enum_rename.rs")
+	src, _ := Parse(f)
+	if len(src.Enums) != 1 || len(src.Enums[0].Variants) != 3 {
+		t.Fatalf("Invalid Enum parse. Found: %q", src.Enums)
+	}
+	attrs := [][]string{
+		{`// rustbuddy(rename = "ok")`},
+		{`#[cfg_attr(any(), rustbuddy(rename = "gone"))]`},
+		nil,
+	}
+	names := []string{"Success", "NotFound", "HTTPError"}
+	for i, v := range src.Enums[0].Variants {
+		if found := VariantAttributes(v); !cmpall(found, attrs[i]) {
+			t.Errorf("Invalid attributes of %q. Expected %q, got %q", v, attrs[i], found)
+		}
+		if VariantName(v) != names[i] {
+			t.Errorf("Invalid name of %q. Expected %q, got %q", v, names[i], VariantName(v))
+		}
+	}
+}
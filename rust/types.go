@@ -0,0 +1,209 @@
+package rust
+
+import (
+	"strings"
+	"unicode"
+)
+
+// The parser keeps types as they are written in the source. These helpers
+// pull them apart for the commands that need to know more.
+
+// SplitGeneric separates a type into its path and generic arguments, ie.
+// HashMap<K, V> gives HashMap and [K V].
+func SplitGeneric(t string) (string, []string) {
+	t = strings.TrimSpace(t)
+	i := indexTop(t, '<')
+	if i == -1 || !strings.HasSuffix(t, ">") {
+		return t, []string{}
+	}
+	args := []string{}
+	for _, a := range SplitTop(t[i+1:len(t)-1], ',') {
+		if a = strings.TrimSpace(a); a != "" {
+			args = append(args, a)
+		}
+	}
+	return strings.TrimSpace(t[:i]), args
+}
+
+// BaseName gives the last segment of a type path without generic arguments,
+// ie. std::collections::HashMap<K, V> gives HashMap.
+func BaseName(t string) string {
+	head, _ := SplitGeneric(t)
+	if i := strings.LastIndex(head, "::"); i != -1 {
+		head = head[i+2:]
+	}
+	return head
+}
+
+// SplitTop splits s at each sep that is not nested within brackets, so the
+// comma in HashMap<K, V> does not separate two arguments.
+func SplitTop(s string, sep rune) []string {
+	var parts []string
+	depth := 0
+	last := 0
+	prev := ' '
+	for i, c := range s {
+		if c == sep && depth == 0 {
+			parts = append(parts, s[last:i])
+			last = i + len(string(c))
+		}
+		depth += bracketDepth(prev, c)
+		prev = c
+	}
+	return append(parts, s[last:])
+}
+
+// GenericParams gives generic parameters as an impl block declares them,
+// which is without defaults, ie. <T: Clone = u8> gives <T: Clone>.
+func GenericParams(generics string) string {
+	var params []string
+	for _, p := range splitParams(generics) {
+		if i := indexTop(p, '='); i != -1 {
+			p = strings.TrimSpace(p[:i])
+		}
+		params = append(params, p)
+	}
+	if len(params) == 0 {
+		return ""
+	}
+	return "<" + strings.Join(params, ", ") + ">"
+}
+
+// GenericArgs gives the arguments naming generic parameters in a type, ie.
+// <'a: 'b, T: Clone, const N: usize> gives <'a, T, N>.
+func GenericArgs(generics string) string {
+	var args []string
+	for _, p := range splitParams(generics) {
+		p = strings.TrimPrefix(p, "const ")
+		if i := strings.IndexAny(p, ":="); i != -1 {
+			p = p[:i]
+		}
+		args = append(args, strings.TrimSpace(p))
+	}
+	if len(args) == 0 {
+		return ""
+	}
+	return "<" + strings.Join(args, ", ") + ">"
+}
+
+// splitParams lists the parameters of generics such as <'a, T: Clone>
+func splitParams(generics string) []string {
+	generics = strings.TrimSpace(generics)
+	generics = strings.TrimSuffix(strings.TrimPrefix(generics, "<"), ">")
+	var params []string
+	for _, p := range SplitTop(generics, ',') {
+		if p = strings.Join(strings.Fields(p), " "); p != "" {
+			params = append(params, p)
+		}
+	}
+	return params
+}
+
+// VariantName gives the name of an enum variant as the parser keeps it, ie.
+// #[default] Second(i32) gives Second.
+func VariantName(v string) string {
+	v = stripAttributes(v)
+	end := strings.IndexFunc(v, func(r rune) bool {
+		return !(r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r))
+	})
+	if end == -1 {
+		return v
+	}
+	return v[:end]
+}
+
+// VariantPattern gives a pattern matching any value of an enum variant, ie.
+// Second(..) for Second(i32) or Third { .. } for Third { a: i32 }.
+func VariantPattern(v string) string {
+	name := VariantName(v)
+	rest := strings.TrimSpace(strings.TrimPrefix(stripAttributes(v), name))
+	switch {
+	case strings.HasPrefix(rest, "("):
+		return name + "(..)"
+	case strings.HasPrefix(rest, "{"):
+		return name + " { .. }"
+	}
+	return name
+}
+
+// IsUnitVariant reports whether an enum variant has no fields
+func IsUnitVariant(v string) bool {
+	return VariantPattern(v) == VariantName(v)
+}
+
+// VariantAttributes lists the attributes of an enum variant, ie.
+// #[default] Second gives [#[default]]. Comments holding attributes for
+// rustbuddy, ie. // rustbuddy(rename = "second"), are listed as well.
+func VariantAttributes(v string) []string {
+	var attrs []string
+	v = strings.TrimSpace(v)
+	for {
+		end := -1
+		switch {
+		case strings.HasPrefix(v, "#["):
+			end = closeParen(v, 1) + 1
+		case strings.HasPrefix(v, "//"):
+			if end = strings.IndexByte(v, '\n'); end == -1 {
+				end = len(v)
+			}
+		}
+		if end == -1 {
+			return attrs
+		}
+		attrs = append(attrs, strings.TrimSpace(v[:end]))
+		v = strings.TrimSpace(v[end:])
+	}
+}
+
+// stripAttributes removes the attributes before an enum variant
+func stripAttributes(v string) string {
+	v = strings.TrimSpace(v)
+	for _, a := range VariantAttributes(v) {
+		v = strings.TrimSpace(strings.TrimPrefix(v, a))
+	}
+	return v
+}
+
+// indexTop is like strings.IndexRune, but ignores runes nested in brackets
+func indexTop(s string, target rune) int {
+	depth := 0
+	prev := ' '
+	for i, c := range s {
+		if c == target && depth == 0 {
+			return i
+		}
+		depth += bracketDepth(prev, c)
+		prev = c
+	}
+	return -1
+}
+
+// closeParen gives the index of the bracket closing the one at open
+func closeParen(s string, open int) int {
+	depth := 0
+	prev := ' '
+	for i, c := range s[open:] {
+		depth += bracketDepth(prev, c)
+		if depth == 0 {
+			return open + i
+		}
+		prev = c
+	}
+	return len(s) - 1
+}
+
+// bracketDepth gives the change in nesting for c. The > of an arrow does not
+// close anything.
+func bracketDepth(prev, c rune) int {
+	switch c {
+	case '(', '[', '{', '<':
+		return 1
+	case ')', ']', '}':
+		return -1
+	case '>':
+		if prev != '-' {
+			return -1
+		}
+	}
+	return 0
+}